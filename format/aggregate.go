@@ -0,0 +1,188 @@
+package format
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// aggregateFuncs maps each aggregate name to the function that combines
+// the values of one field across repeated runs.
+var aggregateFuncs = map[string]func([]float64) float64{
+	"min": func(vs []float64) float64 {
+		m := vs[0]
+		for _, v := range vs[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	},
+	"max": func(vs []float64) float64 {
+		m := vs[0]
+		for _, v := range vs[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	},
+	"mean": func(vs []float64) float64 {
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		return sum / float64(len(vs))
+	},
+}
+
+// ParseAggregate returns the function for Options.Aggregate named by s:
+// "min", "mean", or "max". It returns nil for "".
+func ParseAggregate(s string) (func([]float64) float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, ok := aggregateFuncs[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregate %q (must be min, mean, or max)", s)
+	}
+	return f, nil
+}
+
+// ParsePercentiles parses a comma-separated list of percentiles between 0
+// and 100 for Options.Percentiles.
+func ParsePercentiles(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ps []float64
+	for _, f := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("bad percentile %q (must be a number from 0 to 100)", f)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// Aggregate collapses the repeated runs of each benchmark in g (as from go
+// test -count) into one line at the position of the first run, combining
+// each measured field independently with o.Aggregate. Without o.Aggregate,
+// it collapses them into one line per percentile in o.Percentiles instead,
+// and if there are none it does nothing. Runs are matched by their full
+// names, so those with different GOMAXPROCS suffixes are kept apart.
+func (g *BenchOutputGroup) Aggregate(o *Options) {
+	if o.Aggregate == nil && len(o.Percentiles) == 0 {
+		return
+	}
+	var names []string
+	runs := make(map[string][]*Benchmark)
+	for _, line := range g.Lines {
+		if _, ok := runs[line.Name]; !ok {
+			names = append(names, line.Name)
+		}
+		runs[line.Name] = append(runs[line.Name], line)
+	}
+	if len(names) == len(g.Lines) {
+		return
+	}
+	g.Lines = g.Lines[:0]
+	for _, name := range names {
+		if o.Aggregate != nil || len(runs[name]) == 1 {
+			g.Lines = append(g.Lines, aggregateRuns(runs[name], o.Aggregate))
+			continue
+		}
+		for _, p := range o.Percentiles {
+			b := aggregateRuns(runs[name], func(vs []float64) float64 { return percentile(vs, p) })
+			b.Annotation = "p" + strconv.FormatFloat(p, 'f', -1, 64)
+			// The throughput at the p-th percentile time is that of the
+			// bytes per operation, which are the same for every run.
+			if b.Measured&parse.MBPerS != 0 {
+				first := runs[name][0]
+				b.MBPerS = first.MBPerS * first.NsPerOp / b.NsPerOp
+			}
+			g.Lines = append(g.Lines, b)
+		}
+	}
+	// The baseline came first, so its runs were collapsed first.
+	if g.baseline != nil {
+		g.baseline = g.Lines[0]
+	}
+}
+
+// percentile returns the p-th percentile of vs, interpolating linearly
+// between the nearest values.
+func percentile(vs []float64, p float64) float64 {
+	sorted := append([]float64(nil), vs...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	i := int(rank)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (rank-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// coefficientOfVariation returns the sample standard deviation of the times
+// of lines as a percentage of their mean.
+func coefficientOfVariation(lines []*Benchmark) float64 {
+	var sum float64
+	for _, line := range lines {
+		sum += line.NsPerOp
+	}
+	mean := sum / float64(len(lines))
+	if mean == 0 {
+		return 0
+	}
+	var sq float64
+	for _, line := range lines {
+		d := line.NsPerOp - mean
+		sq += d * d
+	}
+	return math.Sqrt(sq/float64(len(lines)-1)) / mean * 100
+}
+
+func aggregateRuns(lines []*Benchmark, combine func([]float64) float64) *Benchmark {
+	if len(lines) == 1 {
+		return lines[0]
+	}
+	field := func(f func(*Benchmark) float64) float64 {
+		vs := make([]float64, len(lines))
+		for i, line := range lines {
+			vs[i] = f(line)
+		}
+		return combine(vs)
+	}
+	b := &Benchmark{}
+	b.Name = lines[0].Name
+	b.Procs = lines[0].Procs
+	for _, line := range lines {
+		b.Measured |= line.Measured
+	}
+	b.N = int(math.Round(field(func(b *Benchmark) float64 { return float64(b.N) })))
+	b.NsPerOp = field(func(b *Benchmark) float64 { return b.NsPerOp })
+	b.Runs = len(lines)
+	b.CV = coefficientOfVariation(lines)
+	b.MBPerS = field(func(b *Benchmark) float64 { return b.MBPerS })
+	b.AllocedBytesPerOp = uint64(math.Round(field(func(b *Benchmark) float64 { return float64(b.AllocedBytesPerOp) })))
+	b.AllocsPerOp = uint64(math.Round(field(func(b *Benchmark) float64 { return float64(b.AllocsPerOp) })))
+	for _, line := range lines {
+		for unit := range line.Custom {
+			if _, ok := b.Custom[unit]; ok {
+				continue
+			}
+			var vs []float64
+			for _, l := range lines {
+				if v, ok := l.Custom[unit]; ok {
+					vs = append(vs, v)
+				}
+			}
+			if b.Custom == nil {
+				b.Custom = make(map[string]float64)
+			}
+			b.Custom[unit] = combine(vs)
+		}
+	}
+	return b
+}
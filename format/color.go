@@ -0,0 +1,75 @@
+package format
+
+import "strings"
+
+const (
+	colorGreen  = "\x1b[32m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorDim    = "\x1b[2;3m"
+	colorReset  = "\x1b[0m"
+)
+
+// timeColor returns the color for line's time cell: green if line is in the
+// fastest quartile of g, red if it is in the slowest, and "" otherwise. With
+// o.ColorThreshold, it is instead red if line is slower than the threshold
+// and green if not. Lines without a time aren't colored.
+func (g *BenchOutputGroup) timeColor(o *Options, line *Benchmark) string {
+	if !timed(line) {
+		return ""
+	}
+	if o.ColorThreshold > 0 {
+		if line.NsPerOp > float64(o.ColorThreshold.Nanoseconds()) {
+			return colorRed
+		}
+		return colorGreen
+	}
+	faster, slower := 0, 0
+	for _, l := range g.Lines {
+		switch {
+		case !timed(l):
+		case l.NsPerOp < line.NsPerOp:
+			faster++
+		case l.NsPerOp > line.NsPerOp:
+			slower++
+		}
+	}
+	fast := faster*4 < len(g.Lines)
+	slow := slower*4 < len(g.Lines)
+	switch {
+	case fast && !slow:
+		return colorGreen
+	case slow && !fast:
+		return colorRed
+	}
+	return ""
+}
+
+// cvColor returns the color for a coefficient of variation of cv percent:
+// red above o's red threshold, yellow above its yellow one, and "" otherwise.
+func (o *Options) cvColor(cv float64) string {
+	yellow, red := o.CVYellow, o.CVRed
+	if yellow == 0 {
+		yellow = 5
+	}
+	if red == 0 {
+		red = 20
+	}
+	switch {
+	case cv > red:
+		return colorRed
+	case cv > yellow:
+		return colorYellow
+	}
+	return ""
+}
+
+// colorize wraps cell, which occurs in the padded string s, in color.
+// Padding is left outside the escape codes so that they don't count towards
+// the column width.
+func colorize(s, cell, color string) string {
+	if color == "" || cell == "" {
+		return s
+	}
+	return strings.Replace(s, cell, color+cell+colorReset, 1)
+}
@@ -0,0 +1,113 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// columnNames maps the names ParseColumns accepts to the column each one
+// selects, named as in the table header.
+var columnNames = map[string]string{
+	"benchmark":       "benchmark",
+	"rank":            "rank",
+	"percentile_rank": "percentile_rank",
+	"procs":           "procs",
+	"iter":            "iter",
+	"time/iter":       "time/iter",
+	"time":            "time/iter",
+	"ops/sec":         "ops/sec",
+	"cv":              "cv",
+	"ratio":           "ratio",
+	"×median":         "×median",
+	"median":          "×median",
+	"improvement%":    "improvement%",
+	"improvement":     "improvement%",
+	"throughput":      "throughput",
+	"bytes alloc":     "bytes alloc",
+	"bytes":           "bytes alloc",
+	"allocs":          "allocs",
+	"total B":         "total B",
+	"total allocs":    "total allocs",
+	"delta time":      "delta time",
+	"delta allocs":    "delta allocs",
+}
+
+// ParseColumns parses a comma-separated list of columns for Options.Columns.
+// Besides the names in the table header (and a few shorter aliases, such as
+// "bytes" for "bytes alloc"), it accepts the unit of any custom metric, which
+// must contain a slash, as in "widgets/op".
+func ParseColumns(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var columns []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if column, ok := columnNames[name]; ok {
+			columns = append(columns, column)
+			continue
+		}
+		if strings.Contains(name, "/") {
+			columns = append(columns, name)
+			continue
+		}
+		var valid []string
+		for k := range columnNames {
+			valid = append(valid, k)
+		}
+		sort.Strings(valid)
+		return nil, fmt.Errorf("unknown column %q (valid columns: %s, or a custom unit)", name, strings.Join(valid, ", "))
+	}
+	return columns, nil
+}
+
+// columnKey returns the name by which Options.Columns selects the table
+// column named name. The times are also selected by "ops/sec" when they are
+// shown as operations per second.
+func columnKey(name string) string {
+	name = strings.TrimPrefix(name, "scaled ")
+	if name == "ops/sec" {
+		return "time/iter"
+	}
+	return name
+}
+
+// selectColumns reorders the columns of t to follow columns, dropping the
+// rest. Listed columns that t lacks are skipped and returned.
+func (t *Table) selectColumns(columns []string) (missing []string) {
+	var index []int
+	for _, column := range columns {
+		found := false
+		for i, name := range t.Cells[0] {
+			if name == column || columnKey(name) == column {
+				index = append(index, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, column)
+		}
+	}
+	for r, row := range t.Cells {
+		selected := make([]string, len(index))
+		for j, i := range index {
+			selected[j] = row[i]
+		}
+		t.Cells[r] = selected
+	}
+	for r, colors := range t.Colors {
+		if colors == nil {
+			continue
+		}
+		selected := make([]string, len(index))
+		for j, i := range index {
+			if i < len(colors) {
+				selected[j] = colors[i]
+			}
+		}
+		t.Colors[r] = selected
+	}
+	return missing
+}
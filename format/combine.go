@@ -0,0 +1,55 @@
+package format
+
+// Combine formats a single table built from groups. Its rows are the
+// benchmark names seen in any group, its columns are the groups (headed by
+// labels), and each cell holds the time of that benchmark in that group, or
+// "—" if the group did not run it. The caption names the table in formats
+// that support one. opts.Format must be one of the table formats: "table",
+// "csv", "tsv", "markdown", "rst", "latex", or "org".
+func Combine(groups []*BenchOutputGroup, labels []string, caption string, opts Options) string {
+	all := &BenchOutputGroup{}
+	var names []string
+	first := make(map[string]*Benchmark)
+	times := make([]map[string]*Benchmark, len(groups))
+	for i, g := range groups {
+		times[i] = make(map[string]*Benchmark)
+		for _, line := range g.Lines {
+			all.AddLine(line, &Options{})
+			if _, ok := times[i][line.Name]; !ok {
+				times[i][line.Name] = line
+			}
+			if _, ok := first[line.Name]; !ok {
+				first[line.Name] = line
+				names = append(names, line.Name)
+			}
+		}
+	}
+	table := &Table{Cells: [][]string{append([]string{"benchmark"}, labels...)}}
+	timeFormatFunc := all.TimeFormatFunc(&opts)
+	for _, name := range names {
+		row := []string{all.shownName(first[name])}
+		for i := range groups {
+			cell := "—"
+			if line, ok := times[i][name]; ok {
+				cell = timeFormatFunc(line.NsPerOp)
+			}
+			row = append(row, cell)
+		}
+		table.Cells = append(table.Cells, row)
+	}
+	table.findMaxLengths()
+	return opts.render(table, caption)
+}
+
+// CombinePackages formats groups as one table with a column per package.
+func CombinePackages(groups []*BenchOutputGroup, opts Options) string {
+	var labels []string
+	for _, g := range groups {
+		label := g.Package
+		if label == "" {
+			label = "(unknown)"
+		}
+		labels = append(labels, label)
+	}
+	return Combine(groups, labels, "", opts)
+}
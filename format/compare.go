@@ -0,0 +1,134 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// A CompareGroup holds one group of benchmarks from a baseline file.
+type CompareGroup struct {
+	// Benchmark names in input order
+	names []string
+	// The first benchmark of each name and annotation, keyed by compareKey
+	byKey map[string]*Benchmark
+}
+
+func newCompareGroup() *CompareGroup {
+	return &CompareGroup{byKey: make(map[string]*Benchmark)}
+}
+
+// compareKey returns the key of the baseline benchmark to compare line
+// with: one of the same name and, if runs were collapsed by percentile, the
+// same percentile.
+func compareKey(line *Benchmark) string {
+	return line.Name + " " + line.Annotation
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decompress returns a reader of the decompressed contents of r if they are
+// gzip-compressed, and of r itself otherwise.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// LoadCompareFile reads the baseline benchmark output at path, which may be
+// gzip-compressed, for Options.Compare. Repeated runs in it are collapsed
+// like those of the input, by o.Aggregate or o.Percentiles. The groups it
+// returns are keyed by the package path from their ok lines ("" for a final
+// group with no ok line).
+func LoadCompareFile(path string, o *Options) (map[string]*CompareGroup, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := Decompress(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	groups := make(map[string]*CompareGroup)
+	current := &BenchOutputGroup{}
+	// end collapses the runs of the current group and files it under pkg.
+	end := func(pkg string) {
+		current.Aggregate(o)
+		c := newCompareGroup()
+		seen := make(map[string]bool)
+		for _, line := range current.Lines {
+			if !seen[line.Name] {
+				seen[line.Name] = true
+				c.names = append(c.names, line.Name)
+			}
+			if _, ok := c.byKey[compareKey(line)]; !ok {
+				c.byKey[compareKey(line)] = line
+			}
+		}
+		groups[pkg] = c
+		current = &BenchOutputGroup{}
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if line, err := ParseLine(text); err == nil {
+			current.addLine(line)
+			continue
+		}
+		if pkg, ok := ParseOKLine(text); ok && len(current.Lines) > 0 {
+			end(pkg)
+		}
+	}
+	if len(current.Lines) > 0 {
+		end("")
+	}
+	return groups, scanner.Err()
+}
+
+// compareGroup returns the baseline group in groups to compare g against:
+// the one for the same package or, failing that, the only baseline group.
+func (g *BenchOutputGroup) compareGroup(groups map[string]*CompareGroup) *CompareGroup {
+	if c, ok := groups[g.Package]; ok {
+		return c
+	}
+	if len(groups) == 1 {
+		for _, c := range groups {
+			return c
+		}
+	}
+	return newCompareGroup()
+}
+
+// deltas returns the "delta time" and "delta allocs" cells for line, or
+// "N/A" where c has no matching measurement.
+func (c *CompareGroup) deltas(line *Benchmark) []string {
+	base, ok := c.byKey[compareKey(line)]
+	if !ok {
+		return []string{"N/A", "N/A"}
+	}
+	allocs := "N/A"
+	if base.Measured&line.Measured&parse.AllocsPerOp != 0 {
+		allocs = deltaPercent(float64(base.AllocsPerOp), float64(line.AllocsPerOp))
+	}
+	return []string{deltaPercent(base.NsPerOp, line.NsPerOp), allocs}
+}
+
+// deltaPercent formats the change from base to cur as a signed percentage.
+func deltaPercent(base, cur float64) string {
+	if base == 0 {
+		if cur == 0 {
+			return "+0.0%"
+		}
+		return "N/A"
+	}
+	return fmt.Sprintf("%+.1f%%", (cur-base)/base*100)
+}
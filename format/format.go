@@ -0,0 +1,1331 @@
+// Package format lays out the benchmark results printed by go test -bench
+// as tables and other human-friendly formats. It is the library behind the
+// prettybench command.
+package format
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// DefaultPrecision is the number of decimal places that prettybench
+// formats values with by default.
+const DefaultPrecision = 2
+
+// Options controls how benchmark groups are formatted. The zero value
+// formats a plain table, with whole numbers unless Precision is set (usually
+// to DefaultPrecision). The fields correspond to the prettybench flags of
+// the same names; flags that only affect how input is read are handled by
+// the command.
+type Options struct {
+	// Format is the output format: "table" (the default), "json", "csv",
+	// "tsv", "markdown", "rst", "latex", "org", "sparkline", "junit", or
+	// "prometheus". The "junit" format gives a testsuite element per group, which the caller
+	// should wrap in a testsuites element.
+	Format string
+	// LaTeXBooktabs uses booktabs rules in the "latex" format.
+	LaTeXBooktabs bool
+	// ShowPackage shows the package path from the ok line that ended a
+	// group above its table in the "table" and "markdown" formats.
+	ShowPackage bool
+	// ShowGoVersion shows the Go version reported in the output above each
+	// table in the "table" and "markdown" formats, or in a go_version field
+	// in the "json" format.
+	ShowGoVersion bool
+	// Precision is the number of decimal places of times, throughputs, and
+	// other fractional values.
+	Precision int
+	// TrimTrailingZeros drops insignificant trailing zeros from times and
+	// throughputs.
+	TrimTrailingZeros bool
+	// Sort orders the benchmarks of each group; see ParseSort.
+	Sort []CompareFunc
+	// AnnotatePercentile appends each benchmark's percentile rank by time
+	// within its group to its name. The "json", "csv", and "tsv" formats
+	// give it in a percentile_rank field instead.
+	AnnotatePercentile bool
+	// BenchmarkTimeout, if positive, drops the benchmarks of a group once
+	// their cumulative run time (N * ns/op) exceeds it.
+	BenchmarkTimeout time.Duration
+	// RelativeToMedian adds a column showing each time as a multiple of the
+	// group's median time.
+	RelativeToMedian bool
+	// AbbrevNames abbreviates benchmark names to their initials and adds a
+	// legend below the table.
+	AbbrevNames bool
+	// ShowSource appends the source location of each benchmark to its name,
+	// as found by LoadBenchSources.
+	ShowSource bool
+	// MinMBPerS and MaxMBPerS, if positive, drop benchmarks whose
+	// throughput is outside them.
+	MinMBPerS, MaxMBPerS float64
+	// ShowImprovementPct adds a column showing each benchmark's time
+	// improvement over the group's baseline benchmark. With Color,
+	// improvements are green and regressions red.
+	ShowImprovementPct bool
+	// Baseline is the name (without the -GOMAXPROCS suffix) of the
+	// benchmark that, if it comes first in a group, is its baseline.
+	Baseline string
+	// Scale multiplies every ns/op value before formatting. 0 means 1.
+	Scale float64
+	// EmitBenchFormat prints the benchmarks in go test's own format instead
+	// of a table.
+	EmitBenchFormat bool
+	// NoBenchPrefix strips the leading "Benchmark" from names.
+	NoBenchPrefix bool
+	// TimeUnit is the unit for times: "ns", "us", "ms", "s", or "auto" (or
+	// "") to pick one per group from its smallest time.
+	TimeUnit string
+	// Compare holds the baseline groups to show time and alloc deltas
+	// against; see LoadCompareFile.
+	Compare map[string]*CompareGroup
+	// Geomean adds a row with the geometric mean of the times and
+	// allocations in each group.
+	Geomean bool
+	// Summary adds min, mean, and max rows for the times and allocations
+	// in each group.
+	Summary bool
+	// Color colors the fastest and slowest quartile of times in the "table"
+	// format.
+	Color bool
+	// OpsPerSec shows operations per second instead of the time per
+	// operation.
+	OpsPerSec bool
+	// Aggregate collapses repeated runs of a benchmark; see ParseAggregate
+	// and (*BenchOutputGroup).Aggregate.
+	Aggregate func([]float64) float64
+	// Width, if positive, is the width that the "table" format should fit
+	// in. Names that make a table wider are truncated.
+	Width int
+	// StripCommonPrefix removes the longest prefix that the names in a
+	// group share after "Benchmark" from them, and shows it above the table.
+	StripCommonPrefix bool
+	// ShowProcs adds a column with the GOMAXPROCS value of each benchmark,
+	// which is otherwise left out of the names. The column is added anyway
+	// to groups whose benchmarks ran with different values, as with go test
+	// -cpu=4,8, whose rows it alone tells apart.
+	ShowProcs bool
+	// GroupSubBenchmarks sorts sub-benchmarks by their parent and shows
+	// them below a header row holding the parent's name.
+	GroupSubBenchmarks bool
+	// Top, if positive, keeps only the first Top benchmarks of each group
+	// in the Sort order or, if Sort is empty, the Top fastest.
+	Top int
+	// HumanBytes shows allocation sizes of 1024 bytes or more in KB, MB,
+	// and so on.
+	HumanBytes bool
+	// IECBytes shows allocation sizes of 1024 bytes or more in KiB, MiB, and
+	// so on, taking precedence over HumanBytes.
+	IECBytes bool
+	// HumanIters shows iteration counts with K, M, and G suffixes (except in
+	// the "csv" format), taking precedence over ThousandsSep.
+	HumanIters bool
+	// ThousandsSep, if set, separates groups of three digits in iteration
+	// counts (except in the "csv" format).
+	ThousandsSep string
+	// NoHeader leaves out the column names and their underlines in the
+	// "table" format.
+	NoHeader bool
+	// MaxNameWidth, if positive, truncates names in the "table" format to
+	// this many characters, overriding Width.
+	MaxNameWidth int
+	// NameWidth, if positive, makes the name column of the "table" format
+	// exactly this wide, padding or truncating names, so that tables of
+	// different runs line up. It overrides MaxNameWidth and Width. None of
+	// the three apply to tables whose first column isn't the names, as
+	// with Transpose.
+	NameWidth int
+	// Columns, if set, lists the columns of tables in the order to show
+	// them, as returned by ParseColumns. Listed columns that a table lacks,
+	// such as a misspelled custom unit, are reported to Warn.
+	Columns []string
+	// ColorThreshold, if positive, makes Color mark times above it red and
+	// the rest green, instead of coloring the fastest and slowest quartiles.
+	ColorThreshold time.Duration
+	// Percentiles, if Aggregate is nil, collapse the repeated runs of each
+	// benchmark in a group into a row per percentile (such as 50 or 95) of
+	// their times, allocations, and other fields.
+	Percentiles []float64
+	// ShowCV adds a column, when Aggregate is set, with the coefficient of
+	// variation of the times of each benchmark's runs. With Color, it is
+	// yellow above CVYellow percent (default 5) and red above CVRed percent
+	// (default 20).
+	ShowCV          bool
+	CVYellow, CVRed float64
+	// ShowOpsSec adds a column, after the times, with the operations per
+	// second of each benchmark. It is ignored with OpsPerSec, which already
+	// shows them instead of the times.
+	ShowOpsSec bool
+	// Rank adds a column, next to the names, with the rank of each benchmark
+	// by time within its group ("#1" for the fastest), whatever the order
+	// of the rows.
+	Rank bool
+	// Normalize, if "first" or "min", adds a column with each time as a
+	// multiple of the time of the first benchmark of its group or of the
+	// fastest one.
+	Normalize string
+	// ColSep separates the columns of "table" format tables in the plain
+	// style. The default is three spaces.
+	ColSep string
+	// Style selects the characters the "table" format draws tables with.
+	Style TableStyle
+	// ShowTotalAllocs adds columns with the bytes and allocations of all the
+	// iterations of each benchmark (N times the per-op figures).
+	ShowTotalAllocs bool
+	// Transpose lays out tables with a column per benchmark and a row per
+	// metric.
+	Transpose bool
+	// NoCaption leaves out the line naming the goos, goarch, and cpu of a
+	// group above its "table" format table.
+	NoCaption bool
+	// Warn, if set, is called with problems in the input that don't stop
+	// it from being formatted, such as duplicate benchmark names.
+	Warn func(msg string)
+}
+
+// colSep returns the separator between the columns of plain tables.
+func (o *Options) colSep() string {
+	if o.ColSep == "" {
+		return "   "
+	}
+	return o.ColSep
+}
+
+// scale returns the factor to multiply ns/op values by.
+func (o *Options) scale() float64 {
+	if o.Scale == 0 {
+		return 1
+	}
+	return o.Scale
+}
+
+// Format formats each of groups according to opts and returns the results
+// one after the other. The "prometheus" format combines all the groups into
+// one set of metric families instead, and the "json" format into one array.
+//
+// The output depends only on groups and opts: rows keep the order in which
+// their benchmarks were added unless opts.Sort or opts.Top reorders them,
+// and sorting is stable, so benchmarks that compare equal also keep it.
+// Format sorts copies of the groups' lines, so calling it again gives the
+// same output.
+func Format(groups []*BenchOutputGroup, opts Options) string {
+	if opts.Format == "prometheus" {
+		return prometheus(groups)
+	}
+	if opts.Format == "json" && !opts.EmitBenchFormat {
+		return formatJSON(groups, &opts)
+	}
+	var s string
+	for _, g := range groups {
+		s += g.format(&opts)
+	}
+	return s
+}
+
+// A BenchOutputGroup holds the benchmarks of one go test run, which ends
+// with the ok line of its package.
+type BenchOutputGroup struct {
+	// The benchmarks in the order they were added
+	Lines []*Benchmark
+	// Columns which are in use
+	Measured int
+	// Sorted units of the custom metrics reported by any line
+	CustomUnits []string
+	// The Go version reported in the output, if any
+	GoVersion string
+	// The package path from the ok line that ended the group, if any
+	Package string
+	// The goos/goarch/pkg/cpu prologue lines of the go test invocation that
+	// produced the group, if they were collected
+	Prologue []string
+	// The values of the goos, goarch, and cpu prologue lines, if any
+	GOOS, GOARCH, CPU string
+	// Benchmarks left out because the group exceeded Options.BenchmarkTimeout
+	Skipped []*Benchmark
+	// Cumulative run time of the displayed benchmarks
+	elapsed time.Duration
+	// The input file the group was read from, if not stdin
+	File string
+	// The first benchmark of the group, if it is the Options.Baseline
+	// benchmark
+	baseline *Benchmark
+	// How many times each benchmark name has been added
+	seen map[string]int
+}
+
+func (g *BenchOutputGroup) format(o *Options) string {
+	if len(g.Lines) == 0 {
+		return ""
+	}
+	g = g.ordered(o)
+	if o.EmitBenchFormat {
+		return g.RawString()
+	}
+	switch o.Format {
+	case "sparkline":
+		return g.sparkline() + "\n"
+	case "junit":
+		return g.JUnit()
+	}
+	// Lines above the table are only written in the formats where they
+	// can't be mistaken for part of it.
+	var header string
+	plain := o.Format == "table" || o.Format == ""
+	if plain || o.Format == "markdown" {
+		if o.ShowPackage && g.Package != "" {
+			header += "package: " + g.Package + "\n"
+		}
+		for _, line := range g.Prologue {
+			header += line + "\n"
+		}
+		if caption := g.caption(); caption != "" && !o.NoCaption && len(g.Prologue) == 0 && plain {
+			header += caption + "\n"
+		}
+		if o.ShowGoVersion && g.GoVersion != "" {
+			header += "go version: " + g.GoVersion + "\n"
+		}
+		if o.StripCommonPrefix && !o.AbbrevNames {
+			if prefix := g.commonPrefix(); prefix != "" {
+				header += "common prefix: " + prefix + "\n"
+			}
+		}
+	}
+	var footer string
+	if o.AbbrevNames {
+		abbrevs, names := g.abbreviations()
+		for _, name := range names {
+			footer += abbrevs[name] + " = " + name + "\n"
+		}
+	}
+	if len(g.Skipped) > 0 {
+		footer += "skipped (time budget exceeded):\n"
+		for _, line := range g.Skipped {
+			footer += "    " + g.shownName(line) + "\n"
+		}
+	}
+	return header + o.render(g.tabulate(o), g.Package) + footer
+}
+
+// ordered returns a copy of g whose lines are sorted by o.Sort and cut down
+// to o.Top. Sorting works on a copy of the lines, so that g can be formatted
+// again, as in other formats, from the order it was read in.
+func (g *BenchOutputGroup) ordered(o *Options) *BenchOutputGroup {
+	h := *g
+	h.Lines = append([]*Benchmark(nil), g.Lines...)
+	g = &h
+	g.sortLines(o.Sort)
+	if o.Top > 0 && len(g.Lines) > o.Top {
+		if len(o.Sort) == 0 {
+			g.sortLines([]CompareFunc{sortKeys["time"]})
+		}
+		g = g.top(o.Top)
+	}
+	return g
+}
+
+// caption describes the platform that g ran on, as in
+// "goos: linux, goarch: amd64, cpu: ...", or returns "" if it is unknown.
+func (g *BenchOutputGroup) caption() string {
+	var parts []string
+	for _, kv := range [][2]string{{"goos", g.GOOS}, {"goarch", g.GOARCH}, {"cpu", g.CPU}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+": "+kv[1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// render formats table according to o.Format. The caption names the table
+// in formats that support one.
+func (o *Options) render(table *Table, caption string) string {
+	switch o.Format {
+	case "csv":
+		return table.formatCSV()
+	case "tsv":
+		return table.formatTSV()
+	case "markdown":
+		return table.formatMarkdown()
+	case "rst":
+		return table.formatRST()
+	case "latex":
+		return table.formatLaTeX(o.LaTeXBooktabs)
+	case "org":
+		if caption == "" {
+			caption = "benchmarks"
+		}
+		return table.formatOrg(caption)
+	default:
+		// The name width options only apply to a first column of names,
+		// which -columns may move and Transpose turns into a header row.
+		if table.Cells[0][0] == "benchmark" && !o.Transpose {
+			if n := o.nameWidth(table); n > 0 {
+				table.truncateNames(n)
+			}
+			if o.NameWidth > 0 {
+				table.MaxLengths[0] = o.NameWidth
+			}
+		}
+		return table.formatTableCells(!o.NoHeader, o.Style, o.colSep())
+	}
+}
+
+// minNameWidth is the narrowest that Width may make the name column.
+const minNameWidth = len("benchmark")
+
+// nameWidth returns the width to truncate the names of table to, or 0 if
+// they fit.
+func (o *Options) nameWidth(table *Table) int {
+	if o.NameWidth > 0 {
+		return o.NameWidth
+	}
+	if o.MaxNameWidth > 0 {
+		return o.MaxNameWidth
+	}
+	if o.Width <= 0 || table.width(o.Style, o.colSep()) <= o.Width {
+		return 0
+	}
+	n := o.Width - (table.width(o.Style, o.colSep()) - table.MaxLengths[0])
+	if n < minNameWidth {
+		n = minNameWidth
+	}
+	return n
+}
+
+// tabulate lays out g as a Table whose first row holds the column names.
+func (g *BenchOutputGroup) tabulate(o *Options) *Table {
+	timeColumn := "time/iter"
+	if o.OpsPerSec {
+		timeColumn = "ops/sec"
+	}
+	if o.scale() != 1 {
+		timeColumn = "scaled " + timeColumn
+	}
+	columnNames := []string{"benchmark"}
+	if o.Rank {
+		columnNames = append(columnNames, "rank")
+	}
+	pctColumn := o.AnnotatePercentile && (o.Format == "csv" || o.Format == "tsv")
+	if pctColumn {
+		columnNames = append(columnNames, "percentile_rank")
+	}
+	showProcs := o.ShowProcs || g.mixedProcs()
+	if showProcs {
+		columnNames = append(columnNames, "procs")
+	}
+	columnNames = append(columnNames, "iter", timeColumn)
+	timeIndex := len(columnNames) - 1
+	showRate := o.ShowOpsSec && !o.OpsPerSec
+	if showRate {
+		columnNames = append(columnNames, strings.Replace(timeColumn, "time/iter", "ops/sec", 1))
+	}
+	showCV := o.ShowCV && o.Aggregate != nil
+	if showCV {
+		columnNames = append(columnNames, "cv")
+	}
+	if o.Normalize != "" {
+		columnNames = append(columnNames, "ratio")
+	}
+	if o.RelativeToMedian {
+		columnNames = append(columnNames, "×median")
+	}
+	if o.ShowImprovementPct && g.baseline != nil {
+		columnNames = append(columnNames, "improvement%")
+	}
+	if (g.Measured & parse.MBPerS) > 0 {
+		columnNames = append(columnNames, "throughput")
+	}
+	if (g.Measured & parse.AllocedBytesPerOp) > 0 {
+		columnNames = append(columnNames, "bytes alloc")
+	}
+	if (g.Measured & parse.AllocsPerOp) > 0 {
+		columnNames = append(columnNames, "allocs")
+	}
+	if o.ShowTotalAllocs && (g.Measured&parse.AllocedBytesPerOp) > 0 {
+		columnNames = append(columnNames, "total B")
+	}
+	if o.ShowTotalAllocs && (g.Measured&parse.AllocsPerOp) > 0 {
+		columnNames = append(columnNames, "total allocs")
+	}
+	columnNames = append(columnNames, g.CustomUnits...)
+	var compare *CompareGroup
+	if o.Compare != nil {
+		compare = g.compareGroup(o.Compare)
+		columnNames = append(columnNames, "delta time", "delta allocs")
+	}
+	table := &Table{Cells: [][]string{columnNames}}
+	timeFormatFunc := g.TimeFormatFunc(o)
+	if o.OpsPerSec {
+		timeFormatFunc = g.OpsFormatFunc(o)
+	}
+	median := g.MedianNsPerOp()
+	var abbrevs map[string]string
+	if o.AbbrevNames {
+		abbrevs, _ = g.abbreviations()
+	}
+
+	if o.GroupSubBenchmarks {
+		sort.SliceStable(g.Lines, func(i, j int) bool {
+			return parentName(g.Lines[i].Name) < parentName(g.Lines[j].Name)
+		})
+	}
+
+	var norm float64
+	switch o.Normalize {
+	case "first":
+		for _, line := range g.Lines {
+			if timed(line) {
+				norm = line.NsPerOp
+				break
+			}
+		}
+	case "min":
+		norm = g.smallestNsPerOp()
+	}
+	// ratioCell formats the time of line as a multiple of base.
+	ratioCell := func(line *Benchmark, base float64) string {
+		if !timed(line) || base == 0 {
+			return "N/A"
+		}
+		return o.formatFloat(line.NsPerOp/base) + "x"
+	}
+
+	var prefix string
+	if o.StripCommonPrefix {
+		prefix = g.commonPrefix()
+	}
+	// shorten returns the name to show for the benchmark or parent name.
+	shorten := func(name string) string {
+		if prefix != "" {
+			return strings.TrimPrefix(name, prefix)
+		}
+		if o.NoBenchPrefix {
+			return strings.TrimPrefix(name, "Benchmark")
+		}
+		return name
+	}
+
+	for i, line := range g.Lines {
+		base := line.BaseName()
+		name := shorten(base)
+		if o.AbbrevNames {
+			name = abbrevs[line.Name]
+		}
+		if o.GroupSubBenchmarks {
+			parent := parentName(base)
+			if i == 0 || parent != parentName(g.Lines[i-1].BaseName()) {
+				if i > 0 {
+					table.Cells = append(table.Cells, make([]string, len(columnNames)))
+				}
+				if parent != base {
+					header := make([]string, len(columnNames))
+					header[0] = shorten(parent)
+					table.Cells = append(table.Cells, header)
+					if o.Color {
+						table.setColor(len(table.Cells)-1, 0, colorDim)
+					}
+				}
+			}
+			if parent != base && !o.AbbrevNames {
+				name = "  " + base[len(parent)+1:]
+			}
+		}
+		if line.Annotation != "" {
+			name = fmt.Sprintf("%s (%s)", name, line.Annotation)
+		}
+		if o.AnnotatePercentile && !pctColumn {
+			name = fmt.Sprintf("%s (p%d)", name, g.percentileRank(line))
+		}
+		if o.ShowSource {
+			if loc := benchSource(g.Package, line.Name); loc != "" {
+				name = fmt.Sprintf("%s (%s)", name, loc)
+			}
+		}
+		row := []string{name}
+		if o.Rank {
+			row = append(row, "#"+strconv.Itoa(g.rank(line)))
+		}
+		if pctColumn {
+			row = append(row, strconv.Itoa(g.percentileRank(line)))
+		}
+		if showProcs {
+			row = append(row, strconv.Itoa(line.Procs))
+		}
+		row = append(row, o.formatIterations(line.N), measuredCell(line, parse.NsPerOp, func(l *Benchmark) string {
+			return timeFormatFunc(l.NsPerOp)
+		}))
+		if showRate {
+			row = append(row, measuredCell(line, parse.NsPerOp, func(l *Benchmark) string {
+				return o.formatOpsPerSec(l.NsPerOp)
+			}))
+		}
+		cvIndex := len(row)
+		if showCV {
+			cell := ""
+			if line.Runs > 1 {
+				cell = fmt.Sprintf("±%.1f%%", line.CV)
+			}
+			row = append(row, cell)
+		}
+		if o.Normalize != "" {
+			row = append(row, ratioCell(line, norm))
+		}
+		if o.RelativeToMedian {
+			row = append(row, ratioCell(line, median))
+		}
+		improvementIndex := len(row)
+		var improvementColor string
+		if o.ShowImprovementPct && g.baseline != nil {
+			var cell string
+			cell, improvementColor = g.improvement(o, line)
+			row = append(row, cell)
+		}
+		if (g.Measured & parse.MBPerS) > 0 {
+			row = append(row, measuredCell(line, parse.MBPerS, o.FormatMegaBytesPerSecond))
+		}
+		if (g.Measured & parse.AllocedBytesPerOp) > 0 {
+			row = append(row, measuredCell(line, parse.AllocedBytesPerOp, o.FormatBytesAllocPerOp))
+		}
+		if (g.Measured & parse.AllocsPerOp) > 0 {
+			row = append(row, measuredCell(line, parse.AllocsPerOp, FormatAllocsPerOp))
+		}
+		if o.ShowTotalAllocs && (g.Measured&parse.AllocedBytesPerOp) > 0 {
+			row = append(row, measuredCell(line, parse.AllocedBytesPerOp, o.formatTotalBytes))
+		}
+		if o.ShowTotalAllocs && (g.Measured&parse.AllocsPerOp) > 0 {
+			row = append(row, measuredCell(line, parse.AllocsPerOp, formatTotalAllocs))
+		}
+		for _, unit := range g.CustomUnits {
+			cell := ""
+			if v, ok := line.Custom[unit]; ok {
+				cell = o.formatFloat(v) + " " + unit
+			}
+			row = append(row, cell)
+		}
+		if compare != nil {
+			row = append(row, compare.deltas(line)...)
+		}
+		table.Cells = append(table.Cells, row)
+		if o.Color {
+			table.setColor(len(table.Cells)-1, timeIndex, g.timeColor(o, line))
+			if showCV && line.Runs > 1 {
+				table.setColor(len(table.Cells)-1, cvIndex, o.cvColor(line.CV))
+			}
+			if o.ShowImprovementPct && g.baseline != nil {
+				table.setColor(len(table.Cells)-1, improvementIndex, improvementColor)
+			}
+		}
+	}
+	if compare != nil {
+		// Benchmarks only in the baseline get a row of their own.
+		current := make(map[string]bool)
+		for _, line := range g.Lines {
+			current[line.Name] = true
+		}
+		for _, name := range compare.names {
+			if current[name] {
+				continue
+			}
+			row := make([]string, len(columnNames))
+			row[0] = procsSuffix.ReplaceAllString(name, "")
+			row[len(row)-2], row[len(row)-1] = "N/A", "N/A"
+			table.Cells = append(table.Cells, row)
+		}
+	}
+	if o.Summary {
+		table.Cells = append(table.Cells, make([]string, len(columnNames)))
+		for _, label := range []string{"min", "mean", "max"} {
+			table.Cells = append(table.Cells, g.statRow(o, columnNames, timeFormatFunc, label, aggregateFuncs[label]))
+		}
+	}
+	if o.Geomean {
+		table.Cells = append(table.Cells, g.statRow(o, columnNames, timeFormatFunc, "geomean", geomean))
+		table.Summary++
+	}
+	if len(o.Columns) > 0 {
+		for _, column := range table.selectColumns(o.Columns) {
+			if o.Warn != nil {
+				o.Warn(fmt.Sprintf("no column %q in the table; it is left out", column))
+			}
+		}
+	}
+	if o.Transpose {
+		table.transpose()
+	}
+	table.findMaxLengths()
+	return table
+}
+
+// commonPrefix returns the longest prefix, after "Benchmark", that the names
+// of all of g's benchmarks share, including the "Benchmark". It returns ""
+// if there is none or if removing it would leave a name empty.
+func (g *BenchOutputGroup) commonPrefix() string {
+	const bench = "Benchmark"
+	var prefix string
+	for i, line := range g.Lines {
+		name := line.BaseName()
+		if !strings.HasPrefix(name, bench) {
+			return ""
+		}
+		name = name[len(bench):]
+		if i == 0 {
+			prefix = name
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(name) && prefix[n] == name[n] {
+			n++
+		}
+		for n > 0 && n < len(prefix) && !utf8.RuneStart(prefix[n]) {
+			n--
+		}
+		prefix = prefix[:n]
+	}
+	for _, line := range g.Lines {
+		if len(line.BaseName()) == len(bench)+len(prefix) {
+			return ""
+		}
+	}
+	if prefix == "" {
+		return ""
+	}
+	return bench + prefix
+}
+
+// mixedProcs reports whether the benchmarks of g ran with more than one
+// GOMAXPROCS value.
+func (g *BenchOutputGroup) mixedProcs() bool {
+	for _, line := range g.Lines[1:] {
+		if line.Procs != g.Lines[0].Procs {
+			return true
+		}
+	}
+	return false
+}
+
+// shownName returns the name to show for line outside of a table: without
+// its -GOMAXPROCS suffix, like in tables, unless g mixes GOMAXPROCS values
+// and there is no procs column to tell its benchmarks apart.
+func (g *BenchOutputGroup) shownName(line *Benchmark) string {
+	if g.mixedProcs() {
+		return line.Name
+	}
+	return line.BaseName()
+}
+
+// top returns a copy of g holding only its first n benchmarks.
+func (g *BenchOutputGroup) top(n int) *BenchOutputGroup {
+	h := *g
+	h.Lines, h.Measured, h.CustomUnits = nil, 0, nil
+	for _, line := range g.Lines[:n] {
+		h.addLine(line)
+	}
+	return &h
+}
+
+// parentName returns the name of the benchmark that runs the sub-benchmark
+// name (the part before the first slash), or name itself if it is not a
+// sub-benchmark.
+func parentName(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func (g *BenchOutputGroup) hasCustomUnit(unit string) bool {
+	for _, u := range g.CustomUnits {
+		if u == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// statRow returns a table row, laid out by columnNames and labeled label,
+// holding the statistic stat of the times and allocations of g's
+// benchmarks.
+func (g *BenchOutputGroup) statRow(o *Options, columnNames []string, timeFormatFunc func(float64) string, label string, stat func([]float64) float64) []string {
+	// field applies stat to f over the benchmarks that measured the field
+	// selected by bit.
+	field := func(bit int, f func(*Benchmark) float64) float64 {
+		var vs []float64
+		for _, line := range g.Lines {
+			if line.Measured&bit != 0 {
+				vs = append(vs, f(line))
+			}
+		}
+		if len(vs) == 0 {
+			return 0
+		}
+		return stat(vs)
+	}
+	s := &Benchmark{}
+	s.Measured = g.Measured
+	s.NsPerOp = field(parse.NsPerOp, func(b *Benchmark) float64 { return b.NsPerOp })
+	s.AllocedBytesPerOp = uint64(math.Round(field(parse.AllocedBytesPerOp, func(b *Benchmark) float64 { return float64(b.AllocedBytesPerOp) })))
+	s.AllocsPerOp = uint64(math.Round(field(parse.AllocsPerOp, func(b *Benchmark) float64 { return float64(b.AllocsPerOp) })))
+
+	row := make([]string, len(columnNames))
+	for i, name := range columnNames {
+		switch name {
+		case "benchmark":
+			row[i] = label
+		case "time/iter", "scaled time/iter":
+			row[i] = timeFormatFunc(s.NsPerOp)
+		case "ops/sec", "scaled ops/sec":
+			if o.OpsPerSec {
+				row[i] = timeFormatFunc(s.NsPerOp)
+			} else {
+				row[i] = o.formatOpsPerSec(s.NsPerOp)
+			}
+		case "bytes alloc":
+			row[i] = o.FormatBytesAllocPerOp(s)
+		case "allocs":
+			row[i] = FormatAllocsPerOp(s)
+		}
+	}
+	return row
+}
+
+// geomean returns the geometric mean of vs. It is 0 if any value is 0.
+func geomean(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		if v <= 0 {
+			return 0
+		}
+		sum += math.Log(v)
+	}
+	return math.Exp(sum / float64(len(vs)))
+}
+
+// improvement formats how much faster line is than the group's baseline,
+// as a percentage of the baseline's time, and returns the color for it:
+// green if line is faster and red if it is slower. Lines holding a
+// percentile of several runs are compared with the same percentile of the
+// baseline.
+func (g *BenchOutputGroup) improvement(o *Options, line *Benchmark) (cell, color string) {
+	baseline := g.baseline
+	for _, l := range g.Lines {
+		if l.Name == baseline.Name && l.Annotation == line.Annotation {
+			baseline = l
+			break
+		}
+	}
+	if line == baseline {
+		return "baseline", ""
+	}
+	pct := (baseline.NsPerOp - line.NsPerOp) / baseline.NsPerOp * 100
+	switch {
+	case pct > 0:
+		color = colorGreen
+	case pct < 0:
+		color = colorRed
+	}
+	sign := ""
+	if pct >= 0 {
+		sign = "+"
+	}
+	return sign + o.formatFloat(pct) + "%", color
+}
+
+// measuredCell formats the field of line selected by bit, or returns "N/A"
+// if line did not measure it (as when only some benchmarks of a group ran
+// with -benchmem).
+func measuredCell(line *Benchmark, bit int, format func(*Benchmark) string) string {
+	if line.Measured&bit == 0 {
+		return "N/A"
+	}
+	return format(line)
+}
+
+// percentileRank returns the percentage of benchmarks in g that are slower
+// than line.
+func (g *BenchOutputGroup) percentileRank(line *Benchmark) int {
+	slower := 0
+	for _, l := range g.Lines {
+		if l.NsPerOp > line.NsPerOp {
+			slower++
+		}
+	}
+	return slower * 100 / len(g.Lines)
+}
+
+// rank returns the position of line among the benchmarks of g ordered by
+// time, counting from 1. Benchmarks with the same time share a rank.
+func (g *BenchOutputGroup) rank(line *Benchmark) int {
+	faster := 0
+	for _, l := range g.Lines {
+		if l.NsPerOp < line.NsPerOp {
+			faster++
+		}
+	}
+	return faster + 1
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline summarizes g on one line, encoding the relative time of each
+// benchmark as a bar character.
+func (g *BenchOutputGroup) sparkline() string {
+	min, max := g.Lines[0].NsPerOp, g.Lines[0].NsPerOp
+	for _, line := range g.Lines[1:] {
+		if line.NsPerOp < min {
+			min = line.NsPerOp
+		}
+		if line.NsPerOp > max {
+			max = line.NsPerOp
+		}
+	}
+	var bars []rune
+	var names []string
+	for _, line := range g.Lines {
+		i := 0
+		if max > min {
+			i = int((line.NsPerOp-min)/(max-min)*float64(len(sparkChars)-1) + 0.5)
+		}
+		bars = append(bars, sparkChars[i])
+		names = append(names, g.shownName(line))
+	}
+	s := string(bars) + " (" + strings.Join(names, " ") + ")"
+	if g.Package != "" {
+		s = g.Package + ": " + s
+	}
+	return s
+}
+
+// FormatIterations formats an iteration count.
+func FormatIterations(iter int) string {
+	return strconv.FormatInt(int64(iter), 10)
+}
+
+// formatIterations formats an iteration count for a table, with an SI
+// suffix if o.HumanIters is set or with its digits grouped by
+// o.ThousandsSep. CSV and TSV keep plain numbers.
+func (o *Options) formatIterations(iter int) string {
+	s := FormatIterations(iter)
+	if o.Format == "csv" || o.Format == "tsv" {
+		return s
+	}
+	if o.HumanIters {
+		switch {
+		case iter >= 1e9:
+			return fmt.Sprintf("%.1fG", float64(iter)/1e9)
+		case iter >= 1e6:
+			return fmt.Sprintf("%.1fM", float64(iter)/1e6)
+		case iter >= 1e3:
+			return fmt.Sprintf("%.1fK", float64(iter)/1e3)
+		}
+		return s
+	}
+	if o.ThousandsSep == "" {
+		return s
+	}
+	var grouped string
+	for len(s) > 3 && s[len(s)-4] != '-' {
+		grouped = o.ThousandsSep + s[len(s)-3:] + grouped
+		s = s[:len(s)-3]
+	}
+	return s + grouped
+}
+
+// TimeFormatFunc returns a function that formats ns/op values in the unit
+// best suited to the group's smallest time, or in o.TimeUnit if one is set.
+func (g *BenchOutputGroup) TimeFormatFunc(o *Options) func(float64) string {
+	smallest := g.smallestNsPerOp()
+	scale := o.scale()
+	if scale == 1 {
+		return o.timeFormatFunc(smallest)
+	}
+	format := o.timeFormatFunc(smallest * scale)
+	return func(ns float64) string {
+		return format(ns * scale)
+	}
+}
+
+// OpsFormatFunc returns a function that formats an ns/op value as operations
+// per second, with the magnitude prefix best suited to the group's fastest
+// benchmark.
+func (g *BenchOutputGroup) OpsFormatFunc(o *Options) func(float64) string {
+	smallest := g.smallestNsPerOp()
+	scale := o.scale()
+	div, unit := opsUnit(1e9 / (smallest * scale))
+	return func(ns float64) string {
+		return o.formatFloat(1e9/(ns*scale)/div) + " " + unit
+	}
+}
+
+// formatOpsPerSec formats an ns/op value as operations per second, with the
+// magnitude prefix best suited to the value itself.
+func (o *Options) formatOpsPerSec(ns float64) string {
+	ops := 1e9 / (ns * o.scale())
+	div, unit := opsUnit(ops)
+	return o.formatFloat(ops/div) + " " + unit
+}
+
+// opsUnit returns the divisor and unit for showing ops operations per
+// second.
+func opsUnit(ops float64) (float64, string) {
+	switch {
+	case ops >= 1e9:
+		return 1e9, "Gop/s"
+	case ops >= 1e6:
+		return 1e6, "Mop/s"
+	case ops >= 1e3:
+		return 1e3, "Kop/s"
+	}
+	return 1, "op/s"
+}
+
+// timeFormatFunc returns a function that formats times in o.TimeUnit or, if
+// that is "auto", in the unit best suited to a column whose smallest time is
+// smallest.
+func (o *Options) timeFormatFunc(smallest float64) func(float64) string {
+	unit := o.TimeUnit
+	if unit == "" || unit == "auto" {
+		switch {
+		case smallest < float64(10000*time.Nanosecond):
+			unit = "ns"
+		case smallest < float64(time.Millisecond):
+			unit = "us"
+		case smallest < float64(10*time.Second):
+			unit = "ms"
+		default:
+			unit = "s"
+		}
+	}
+	switch unit {
+	case "ns":
+		return func(ns float64) string {
+			return o.formatFloat(ns) + " ns/op"
+		}
+	case "us":
+		return func(ns float64) string {
+			return o.formatFloat(ns/1000) + " μs/op"
+		}
+	case "ms":
+		return func(ns float64) string {
+			return o.formatFloat(ns/1e6) + " ms/op"
+		}
+	default:
+		return func(ns float64) string {
+			return o.formatFloat(ns/1e9) + " s/op"
+		}
+	}
+}
+
+// formatFloat formats f with o.Precision decimal places, dropping
+// insignificant trailing zeros if o.TrimTrailingZeros is set.
+func (o *Options) formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', o.Precision, 64)
+	if o.TrimTrailingZeros && strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// timed reports whether line has a time to compare with others: one that
+// was measured and isn't zero, as the time of a line that was only partly
+// parsed may be.
+func timed(line *Benchmark) bool {
+	return line.Measured&parse.NsPerOp != 0 && line.NsPerOp > 0
+}
+
+// smallestNsPerOp returns the smallest time of the benchmarks in g, ignoring
+// those without one, or 0 if none has one.
+func (g *BenchOutputGroup) smallestNsPerOp() float64 {
+	var smallest float64
+	for _, line := range g.Lines {
+		if timed(line) && (smallest == 0 || line.NsPerOp < smallest) {
+			smallest = line.NsPerOp
+		}
+	}
+	return smallest
+}
+
+// MedianNsPerOp returns the median time of the benchmarks in g, ignoring
+// those without one, or 0 if none has one.
+func (g *BenchOutputGroup) MedianNsPerOp() float64 {
+	var times []float64
+	for _, line := range g.Lines {
+		if timed(line) {
+			times = append(times, line.NsPerOp)
+		}
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	sort.Float64s(times)
+	mid := len(times) / 2
+	if len(times)%2 == 0 {
+		return (times[mid-1] + times[mid]) / 2
+	}
+	return times[mid]
+}
+
+// FormatMegaBytesPerSecond formats the throughput of l, or returns "" if l
+// did not measure it.
+func (o *Options) FormatMegaBytesPerSecond(l *Benchmark) string {
+	if (l.Measured & parse.MBPerS) == 0 {
+		return ""
+	}
+	return o.formatFloat(l.MBPerS) + " MB/s"
+}
+
+// FormatBytesAllocPerOp formats the bytes allocated per operation by l, or
+// returns "" if l did not measure them. With o.IECBytes or o.HumanBytes,
+// sizes of 1024 bytes or more are shown in KiB or KB, MiB or MB, and so on.
+func (o *Options) FormatBytesAllocPerOp(l *Benchmark) string {
+	if (l.Measured & parse.AllocedBytesPerOp) == 0 {
+		return ""
+	}
+	return o.formatByteCount(l.AllocedBytesPerOp) + "/op"
+}
+
+// formatByteCount formats n bytes in the units selected by o.
+func (o *Options) formatByteCount(n uint64) string {
+	switch {
+	case n < 1024:
+	case o.IECBytes:
+		return formatIECBytes(n)
+	case o.HumanBytes:
+		return formatBytes(n)
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// formatBytes formats n, which is at least 1024, with two decimal places in
+// the largest binary unit it reaches.
+func formatBytes(n uint64) string {
+	v := float64(n)
+	units := []string{"KB", "MB", "GB", "TB", "PB", "EB"}
+	i := 0
+	for v /= 1024; v >= 1024 && i < len(units)-1; v /= 1024 {
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", v, units[i])
+}
+
+// formatIECBytes formats n, which is at least 1024, in the largest IEC
+// binary unit it reaches, with two decimal places unless it is a whole
+// number of them.
+func formatIECBytes(n uint64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	i, div := 0, uint64(1024)
+	for n/div >= 1024 && i < len(units)-1 {
+		i++
+		div *= 1024
+	}
+	if n%div == 0 {
+		return fmt.Sprintf("%d %s", n/div, units[i])
+	}
+	return fmt.Sprintf("%.2f %s", float64(n)/float64(div), units[i])
+}
+
+// FormatAllocsPerOp formats the allocations per operation of l, or returns
+// "" if l did not measure them.
+func FormatAllocsPerOp(l *Benchmark) string {
+	if (l.Measured & parse.AllocsPerOp) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d allocs/op", l.AllocsPerOp)
+}
+
+// formatTotalBytes formats the bytes allocated by all l.N iterations of l.
+func (o *Options) formatTotalBytes(l *Benchmark) string {
+	return o.formatByteCount(uint64(l.N) * l.AllocedBytesPerOp)
+}
+
+// formatTotalAllocs formats the allocations made by all l.N iterations of
+// l.
+func formatTotalAllocs(l *Benchmark) string {
+	return fmt.Sprintf("%d allocs", uint64(l.N)*l.AllocsPerOp)
+}
+
+// AddLine adds line to g unless it is dropped by the throughput or time
+// budget limits of o.
+func (g *BenchOutputGroup) AddLine(line *Benchmark, o *Options) {
+	if line.Measured&parse.MBPerS != 0 {
+		if (o.MinMBPerS > 0 && line.MBPerS < o.MinMBPerS) || (o.MaxMBPerS > 0 && line.MBPerS > o.MaxMBPerS) {
+			return
+		}
+	}
+	if o.BenchmarkTimeout > 0 && g.elapsed > o.BenchmarkTimeout {
+		g.Skipped = append(g.Skipped, line)
+		return
+	}
+	g.elapsed += time.Duration(float64(line.N) * line.NsPerOp)
+	if len(g.Lines) == 0 && o.Baseline != "" && line.BaseName() == o.Baseline {
+		g.baseline = line
+	}
+	if g.seen == nil {
+		g.seen = make(map[string]int)
+	}
+	g.seen[line.Name]++
+	if g.seen[line.Name] == 2 && o.Aggregate == nil && len(o.Percentiles) == 0 && o.Warn != nil {
+		o.Warn("duplicate benchmark name " + line.Name)
+	}
+	g.addLine(line)
+}
+
+func (g *BenchOutputGroup) addLine(line *Benchmark) {
+	g.Lines = append(g.Lines, line)
+	g.Measured |= line.Measured
+	for unit := range line.Custom {
+		if !g.hasCustomUnit(unit) {
+			g.CustomUnits = append(g.CustomUnits, unit)
+			sort.Strings(g.CustomUnits)
+		}
+	}
+}
+
+// A Benchmark is one parsed benchmark result line. It is the only benchmark
+// type in prettybench: the standard fields and their Measured bits come from
+// the embedded golang.org/x/tools/benchmark/parse.Benchmark, which ParseLine
+// uses to parse them, and Benchmark adds what that package doesn't read.
+type Benchmark struct {
+	parse.Benchmark
+	// Metrics reported with b.ReportMetric, keyed by unit (such as
+	// "widgets/op")
+	Custom map[string]float64
+	// The GOMAXPROCS value from the -N suffix of Name
+	Procs int
+	// The number of runs that Options.Aggregate combined into this line,
+	// and the coefficient of variation of their times in percent; Runs is
+	// 0 for lines that weren't aggregated
+	Runs int
+	CV   float64
+	// A note shown after the name in tables, such as "p95" for a line
+	// that holds the 95th percentiles of several runs
+	Annotation string
+}
+
+// knownUnits are the units that parse.ParseLine understands.
+var knownUnits = map[string]bool{
+	"ns/op":     true,
+	"MB/s":      true,
+	"B/op":      true,
+	"allocs/op": true,
+}
+
+var (
+	benchLineMatcher = regexp.MustCompile(`^Benchmark.*\t.*\d+`)
+	okLineMatcher    = regexp.MustCompile(`^ok\s`)
+)
+
+// ErrNotBenchLine is returned by ParseLine for lines that are not benchmark
+// results.
+var ErrNotBenchLine = errors.New("not a bench line")
+
+// ParseLine parses a benchmark result line printed by go test. A trailing
+// \r, as from output written on Windows, is ignored.
+func ParseLine(line string) (*Benchmark, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if !benchLineMatcher.MatchString(line) {
+		return nil, ErrNotBenchLine
+	}
+	fields := strings.Split(line, "\t")
+	if len(fields) < 3 {
+		return nil, ErrNotBenchLine
+	}
+
+	b, err := parse.ParseLine(line)
+	fields = strings.Fields(line)
+	if err != nil {
+		// Keep lines that are only partly malformed, such as with an
+		// iteration count that isn't an integer.
+		if b = parsePartial(fields); b == nil {
+			return nil, err
+		}
+	}
+	bench := &Benchmark{Benchmark: *b, Procs: benchProcs(b.Name)}
+	for i := 2; i+1 < len(fields); i += 2 {
+		unit := fields[i+1]
+		if knownUnits[unit] {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			continue
+		}
+		if bench.Custom == nil {
+			bench.Custom = make(map[string]float64)
+		}
+		bench.Custom[unit] = v
+	}
+	return bench, nil
+}
+
+// parsePartial parses the fields of a benchmark line that parse.ParseLine
+// rejected, keeping whichever measurements it can read. The iteration count
+// is 0 unless it is a number. It returns nil if no measurement is readable.
+func parsePartial(fields []string) *parse.Benchmark {
+	b := &parse.Benchmark{Name: fields[0]}
+	if n, err := strconv.ParseFloat(fields[1], 64); err == nil {
+		b.N = int(n)
+	}
+	for i := 2; i+1 < len(fields); i += 2 {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[i+1] {
+		case "ns/op":
+			b.NsPerOp = v
+			b.Measured |= parse.NsPerOp
+		case "MB/s":
+			b.MBPerS = v
+			b.Measured |= parse.MBPerS
+		case "B/op":
+			b.AllocedBytesPerOp = uint64(v)
+			b.Measured |= parse.AllocedBytesPerOp
+		case "allocs/op":
+			b.AllocsPerOp = uint64(v)
+			b.Measured |= parse.AllocsPerOp
+		}
+	}
+	if b.Measured == 0 {
+		return nil
+	}
+	return b
+}
+
+// ParseOKLine reports whether line is the ok line that go test prints after
+// a package's tests pass and, if so, returns the package path it names.
+func ParseOKLine(line string) (pkg string, ok bool) {
+	if !okLineMatcher.MatchString(line) {
+		return "", false
+	}
+	if fields := strings.Fields(line); len(fields) > 1 {
+		pkg = fields[1]
+	}
+	return pkg, true
+}
+
+// BaseName returns the name of b without its -GOMAXPROCS suffix.
+func (b *Benchmark) BaseName() string {
+	return procsSuffix.ReplaceAllString(b.Name, "")
+}
+
+// benchProcs returns the GOMAXPROCS value recorded in the -N suffix of a
+// benchmark name. go test omits the suffix when GOMAXPROCS is 1.
+func benchProcs(name string) int {
+	suffix := procsSuffix.FindString(name)
+	if suffix == "" {
+		return 1
+	}
+	n, err := strconv.Atoi(suffix[1:])
+	if err != nil {
+		return 1
+	}
+	return n
+}
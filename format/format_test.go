@@ -0,0 +1,140 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+// parseGroup parses the benchmark lines of output into a group.
+func parseGroup(t *testing.T, output string, o *Options) *BenchOutputGroup {
+	t.Helper()
+	g := &BenchOutputGroup{}
+	for _, text := range strings.Split(output, "\n") {
+		line, err := ParseLine(text)
+		if err == ErrNotBenchLine {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseLine(%q): %s", text, err)
+		}
+		g.AddLine(line, o)
+	}
+	return g
+}
+
+const deterministicInput = `BenchmarkEncode/json-8   	 1000000	      1200 ns/op	     320 B/op	       4 allocs/op
+BenchmarkDecode/json-8   	  500000	      2400 ns/op	     640 B/op	       9 allocs/op
+BenchmarkEncode/xml-8    	  200000	      5100 ns/op	    1024 B/op	      12 allocs/op
+BenchmarkDecode/xml-8    	  100000	      9800 ns/op	    2048 B/op	      31 allocs/op
+BenchmarkHash-8          	 5000000	       300 ns/op	       0 B/op	       0 allocs/op
+BenchmarkHashTie-8       	 5000000	       300 ns/op	       0 B/op	       0 allocs/op
+BenchmarkEncode/gob-8    	  300000	      5100 ns/op	     900 B/op	      20 allocs/op
+`
+
+func TestFormatDeterministic(t *testing.T) {
+	sortByAllocs, err := ParseSort("allocs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"sort", Options{Sort: sortByAllocs}},
+		{"top", Options{Top: 4}},
+		{"group-sub-benchmarks", Options{GroupSubBenchmarks: true}},
+		{"json", Options{Format: "json", Top: 3}},
+		{"csv", Options{Format: "csv", Sort: sortByAllocs}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := parseGroup(t, deterministicInput, &tt.opts)
+			var names []string
+			for _, line := range g.Lines {
+				names = append(names, line.Name)
+			}
+			groups := []*BenchOutputGroup{g}
+			want := Format(groups, tt.opts)
+			for i := 0; i < 100; i++ {
+				if got := Format(groups, tt.opts); got != want {
+					t.Fatalf("run %d gave different output:\n%s\nwant:\n%s", i, got, want)
+				}
+			}
+			for i, line := range g.Lines {
+				if line.Name != names[i] {
+					t.Fatalf("Format reordered its input: line %d is %s, want %s", i, line.Name, names[i])
+				}
+			}
+			// Formatting with other options in between must not change the
+			// output either.
+			Format(groups, Options{Sort: sortByAllocs, GroupSubBenchmarks: true})
+			if got := Format(groups, tt.opts); got != want {
+				t.Fatalf("output changed after formatting with other options:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		text   string
+		want   Benchmark
+		custom map[string]float64
+		table  string
+	}{
+		{
+			name: "time",
+			text: "BenchmarkFoo-8   \t 1000000\t      1200 ns/op\r\n",
+			want: Benchmark{Procs: 8},
+			table: `benchmark         iter       time/iter
+---------         ----       ---------
+BenchmarkFoo   1000000   1200.00 ns/op
+`,
+		},
+		{
+			name: "benchmem",
+			text: "BenchmarkFoo-8   \t 1000000\t      1200 ns/op\t     320 B/op\t       4 allocs/op\r\n",
+			want: Benchmark{Procs: 8},
+			table: `benchmark         iter       time/iter   bytes alloc        allocs
+---------         ----       ---------   -----------        ------
+BenchmarkFoo   1000000   1200.00 ns/op      320 B/op   4 allocs/op
+`,
+		},
+		{
+			name:   "custom metric",
+			text:   "BenchmarkFoo   \t 1000000\t      1200 ns/op\t       7.50 widgets/op\r\n",
+			want:   Benchmark{Procs: 1},
+			custom: map[string]float64{"widgets/op": 7.5},
+			table: `benchmark         iter       time/iter        widgets/op
+---------         ----       ---------        ----------
+BenchmarkFoo   1000000   1200.00 ns/op   7.50 widgets/op
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Scanning by lines leaves the \r on each line.
+			text := strings.TrimSuffix(tt.text, "\n")
+			got, err := ParseLine(text)
+			if err != nil {
+				t.Fatalf("ParseLine(%q): %s", text, err)
+			}
+			if strings.Contains(got.Name, "\r") || got.N != 1000000 || got.NsPerOp != 1200 || got.Procs != tt.want.Procs {
+				t.Errorf("ParseLine(%q) = %+v", text, *got)
+			}
+			if len(got.Custom) != len(tt.custom) {
+				t.Errorf("ParseLine(%q).Custom = %v, want %v", text, got.Custom, tt.custom)
+			}
+			for unit, v := range tt.custom {
+				if got.Custom[unit] != v {
+					t.Errorf("ParseLine(%q).Custom[%q] = %v, want %v", text, unit, got.Custom[unit], v)
+				}
+			}
+			opts := Options{Precision: DefaultPrecision}
+			table := Format([]*BenchOutputGroup{parseGroup(t, text, &opts)}, opts)
+			if table != tt.table {
+				t.Errorf("table of %q:\n%s\nwant:\n%s", text, table, tt.table)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package format
+
+import (
+	"encoding/json"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// BenchJSON is the JSON form of a benchmark. Fields that the benchmark did
+// not measure are omitted. Type and GroupID are only set for streamed
+// events, Package only if the benchmark's ok line named it, GoVersion only
+// with Options.ShowGoVersion, and PercentileRank only with
+// Options.AnnotatePercentile.
+type BenchJSON struct {
+	Type              string   `json:"type,omitempty"`
+	GroupID           int      `json:"group_id,omitempty"`
+	Package           string   `json:"package,omitempty"`
+	GoVersion         string   `json:"go_version,omitempty"`
+	Name              string   `json:"name"`
+	Iterations        int      `json:"iterations"`
+	NsPerOp           *float64 `json:"ns_per_op,omitempty"`
+	MBPerS            *float64 `json:"mb_per_s,omitempty"`
+	AllocedBytesPerOp *uint64  `json:"bytes_alloc_per_op,omitempty"`
+	AllocsPerOp       *uint64  `json:"allocs_per_op,omitempty"`
+	PercentileRank    *int     `json:"percentile_rank,omitempty"`
+}
+
+// NewBenchJSON returns the JSON form of b.
+func NewBenchJSON(b *Benchmark) *BenchJSON {
+	j := &BenchJSON{Name: b.Name, Iterations: b.N}
+	if b.Measured&parse.NsPerOp != 0 {
+		j.NsPerOp = &b.NsPerOp
+	}
+	if b.Measured&parse.MBPerS != 0 {
+		j.MBPerS = &b.MBPerS
+	}
+	if b.Measured&parse.AllocedBytesPerOp != 0 {
+		j.AllocedBytesPerOp = &b.AllocedBytesPerOp
+	}
+	if b.Measured&parse.AllocsPerOp != 0 {
+		j.AllocsPerOp = &b.AllocsPerOp
+	}
+	return j
+}
+
+// JSON returns the benchmarks of g as an indented JSON array.
+func (g *BenchOutputGroup) JSON() string {
+	return formatJSON([]*BenchOutputGroup{g}, &Options{})
+}
+
+// formatJSON returns the benchmarks of all of groups, ordered by o, as one
+// indented JSON array.
+func formatJSON(groups []*BenchOutputGroup, o *Options) string {
+	benchmarks := []*BenchJSON{}
+	for _, g := range groups {
+		g = g.ordered(o)
+		for _, line := range g.Lines {
+			j := NewBenchJSON(line)
+			j.Package = g.Package
+			if o.ShowGoVersion {
+				j.GoVersion = g.GoVersion
+			}
+			if o.AnnotatePercentile {
+				rank := g.percentileRank(line)
+				j.PercentileRank = &rank
+			}
+			benchmarks = append(benchmarks, j)
+		}
+	}
+	b, err := json.MarshalIndent(benchmarks, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b) + "\n"
+}
@@ -0,0 +1,59 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// junitSuite is the JUnit XML form of a group.
+type junitSuite struct {
+	XMLName xml.Name    `xml:"testsuite"`
+	Name    string      `xml:"name,attr"`
+	Tests   int         `xml:"tests,attr"`
+	Time    string      `xml:"time,attr"`
+	Cases   []junitCase `xml:"testcase"`
+}
+
+// junitCase is the JUnit XML form of a benchmark. Its time is the time of
+// one operation.
+type junitCase struct {
+	Classname string `xml:"classname,attr"`
+	Name      string `xml:"name,attr"`
+	Time      string `xml:"time,attr"`
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+// JUnit returns g as a JUnit XML testsuite element with a testcase per
+// benchmark. Benchmarks that allocate also carry their full result line.
+func (g *BenchOutputGroup) JUnit() string {
+	suite := junitSuite{Name: g.Package, Tests: len(g.Lines)}
+	var total time.Duration
+	for _, line := range g.Lines {
+		total += time.Duration(float64(line.N) * line.NsPerOp)
+		c := junitCase{
+			Classname: g.Package,
+			Name:      line.Name,
+			Time:      formatSeconds(line.NsPerOp / 1e9),
+		}
+		if line.Measured&parse.AllocsPerOp != 0 && line.AllocsPerOp > 0 {
+			var buf bytes.Buffer
+			writeBenchLine(&buf, line, 0)
+			c.SystemOut = buf.String()
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = formatSeconds(total.Seconds())
+	b, err := xml.MarshalIndent(suite, "  ", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(b) + "\n"
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
@@ -0,0 +1,52 @@
+package format
+
+import (
+	"strconv"
+	"unicode"
+)
+
+// abbreviate shortens a benchmark name to the first letter of each word,
+// where a word is a camel-case word or a run of capitals:
+// BenchmarkHTTPServerWithMiddleware becomes BHSWM.
+func abbreviate(name string) string {
+	runes := []rune(name)
+	var abbrev []rune
+	for i, r := range runes {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case i == 0 || !unicode.IsLetter(runes[i-1]):
+		case unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]):
+		case unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			// The last capital of a run followed by lower case starts a
+			// new word, as the S in HTTPServer.
+		default:
+			continue
+		}
+		abbrev = append(abbrev, r)
+	}
+	return string(abbrev)
+}
+
+// abbreviations returns the abbreviation of each distinct benchmark name in
+// g, along with the names in order of first appearance. Names that would
+// share an abbreviation are told apart by a numeric suffix.
+func (g *BenchOutputGroup) abbreviations() (map[string]string, []string) {
+	abbrevs := make(map[string]string)
+	counts := make(map[string]int)
+	var names []string
+	for _, line := range g.Lines {
+		if _, ok := abbrevs[line.Name]; ok {
+			continue
+		}
+		abbrev := abbreviate(line.Name)
+		counts[abbrev]++
+		if n := counts[abbrev]; n > 1 {
+			abbrev += strconv.Itoa(n)
+		}
+		abbrevs[line.Name] = abbrev
+		names = append(names, line.Name)
+	}
+	return abbrevs, names
+}
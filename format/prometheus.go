@@ -0,0 +1,72 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// A promFamily is a metric family of the "prometheus" format.
+type promFamily struct {
+	name  string
+	help  string
+	bit   int
+	value func(*Benchmark) float64
+}
+
+var promFamilies = []promFamily{
+	{"bench_ns_per_op", "Time per benchmark operation in nanoseconds.", parse.NsPerOp, func(b *Benchmark) float64 { return b.NsPerOp }},
+	{"bench_allocs_per_op", "Heap allocations per benchmark operation.", parse.AllocsPerOp, func(b *Benchmark) float64 { return float64(b.AllocsPerOp) }},
+	{"bench_bytes_alloc_per_op", "Bytes allocated per benchmark operation.", parse.AllocedBytesPerOp, func(b *Benchmark) float64 { return float64(b.AllocedBytesPerOp) }},
+	{"bench_mb_per_second", "Benchmark throughput in megabytes per second.", parse.MBPerS, func(b *Benchmark) float64 { return b.MBPerS }},
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheus returns the benchmarks of groups as gauges in the Prometheus
+// text exposition format. All groups must be formatted together, because
+// the samples of a metric family have to follow its HELP and TYPE lines.
+// Families that no benchmark measured are left out. A series may only
+// appear once, so benchmarks that ran more than once in a package (as with
+// go test -count, unless Options.Aggregate collapsed the runs) get a run
+// label numbering their runs from 1.
+func prometheus(groups []*BenchOutputGroup) string {
+	type series struct{ pkg, name string }
+	total := make(map[series]int)
+	for _, g := range groups {
+		for _, line := range g.Lines {
+			total[series{g.Package, line.Name}]++
+		}
+	}
+	var buf bytes.Buffer
+	for _, f := range promFamilies {
+		wroteHeader := false
+		runs := make(map[series]int)
+		for _, g := range groups {
+			for _, line := range g.Lines {
+				s := series{g.Package, line.Name}
+				runs[s]++
+				if line.Measured&f.bit == 0 {
+					continue
+				}
+				if !wroteHeader {
+					fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+					fmt.Fprintf(&buf, "# TYPE %s gauge\n", f.name)
+					wroteHeader = true
+				}
+				labels := fmt.Sprintf(`benchmark="%s"`, promLabelEscaper.Replace(line.Name))
+				if g.Package != "" {
+					labels = fmt.Sprintf(`package="%s",`, promLabelEscaper.Replace(g.Package)) + labels
+				}
+				if total[s] > 1 {
+					labels += fmt.Sprintf(`,run="%d"`, runs[s])
+				}
+				fmt.Fprintf(&buf, "%s{%s} %s\n", f.name, labels, strconv.FormatFloat(f.value(line), 'g', -1, 64))
+			}
+		}
+	}
+	return buf.String()
+}
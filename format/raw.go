@@ -0,0 +1,95 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// RawString returns the benchmarks of g in the format go test prints them,
+// so that they can be fed to other tools such as benchstat.
+func (g *BenchOutputGroup) RawString() string {
+	// go test pads names to the longest, plus room for a -GOMAXPROCS suffix
+	// again and a space; without -cpu, the suffix is the same for every
+	// benchmark.
+	nameWidth := 0
+	for _, line := range g.Lines {
+		if n := len(line.Name) + len(procsSuffix.FindString(line.Name)) + 1; n > nameWidth {
+			nameWidth = n
+		}
+	}
+	var buf bytes.Buffer
+	for _, line := range g.Lines {
+		writeBenchLine(&buf, line, nameWidth)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// String returns b as the result line go test prints for it, with only the
+// fields set in b.Measured (and its custom metrics). ParseLine parses it back
+// into an equal Benchmark, up to the rounding of the values.
+func (b *Benchmark) String() string {
+	var buf bytes.Buffer
+	writeBenchLine(&buf, b, 0)
+	return buf.String()
+}
+
+// writeBenchLine writes b as a go test benchmark result line (without the
+// trailing newline), padding the name to nameWidth. Only the fields set in
+// b.Measured are written, in the order and widths of
+// testing.BenchmarkResult's String and MemString: the time, the throughput,
+// the custom metrics, and the allocations last.
+func writeBenchLine(buf *bytes.Buffer, b *Benchmark, nameWidth int) {
+	fmt.Fprintf(buf, "%-*s\t%8d", nameWidth, b.Name, b.N)
+	if b.Measured&parse.NsPerOp != 0 {
+		buf.WriteByte('\t')
+		writeTestingFloat(buf, b.NsPerOp, "ns/op")
+	}
+	if b.Measured&parse.MBPerS != 0 {
+		fmt.Fprintf(buf, "\t%7.2f MB/s", b.MBPerS)
+	}
+	var units []string
+	for unit := range b.Custom {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		buf.WriteByte('\t')
+		writeTestingFloat(buf, b.Custom[unit], unit)
+	}
+	if b.Measured&parse.AllocedBytesPerOp != 0 {
+		fmt.Fprintf(buf, "\t%8d B/op", b.AllocedBytesPerOp)
+	}
+	if b.Measured&parse.AllocsPerOp != 0 {
+		fmt.Fprintf(buf, "\t%8d allocs/op", b.AllocsPerOp)
+	}
+}
+
+// writeTestingFloat writes x with unit using the precision rules of the
+// testing package, which shows more decimals for smaller values.
+func writeTestingFloat(buf *bytes.Buffer, x float64, unit string) {
+	var format string
+	switch y := math.Abs(x); {
+	case y == 0 || y >= 999.95:
+		format = "%10.0f %s"
+	case y >= 99.995:
+		format = "%12.1f %s"
+	case y >= 9.9995:
+		format = "%13.2f %s"
+	case y >= 0.99995:
+		format = "%14.3f %s"
+	case y >= 0.099995:
+		format = "%15.4f %s"
+	case y >= 0.0099995:
+		format = "%16.5f %s"
+	case y >= 0.00099995:
+		format = "%17.6f %s"
+	default:
+		format = "%18.7f %s"
+	}
+	fmt.Fprintf(buf, format, x, unit)
+}
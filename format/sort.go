@@ -0,0 +1,103 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A CompareFunc compares two benchmarks, returning a negative number if a
+// sorts before b, a positive number if a sorts after b, and 0 if they are
+// equal.
+type CompareFunc func(a, b *Benchmark) int
+
+// sortKeys maps each sort key to the ordering it selects.
+var sortKeys = map[string]CompareFunc{
+	"name": func(a, b *Benchmark) int {
+		return strings.Compare(a.Name, b.Name)
+	},
+	"name-length": func(a, b *Benchmark) int {
+		return utf8.RuneCountInString(a.Name) - utf8.RuneCountInString(b.Name)
+	},
+	"iter": func(a, b *Benchmark) int {
+		return compareFloats(float64(a.N), float64(b.N))
+	},
+	"time": func(a, b *Benchmark) int {
+		return compareFloats(a.NsPerOp, b.NsPerOp)
+	},
+	"throughput": func(a, b *Benchmark) int {
+		return compareFloats(a.MBPerS, b.MBPerS)
+	},
+	"bytes": func(a, b *Benchmark) int {
+		return compareFloats(float64(a.AllocedBytesPerOp), float64(b.AllocedBytesPerOp))
+	},
+	"allocs": func(a, b *Benchmark) int {
+		return compareFloats(float64(a.AllocsPerOp), float64(b.AllocsPerOp))
+	},
+}
+
+func init() {
+	sortKeys["mb"] = sortKeys["throughput"]
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+const maxSortKeys = 3
+
+// ParseSort parses a sort order for Options.Sort: up to three
+// comma-separated keys (name, name-length, iter, time, throughput or mb,
+// bytes, allocs), each of which may be prefixed with "-" to reverse it.
+// Later keys break ties left by earlier ones.
+func ParseSort(s string) ([]CompareFunc, error) {
+	if s == "" {
+		return nil, nil
+	}
+	keys := strings.Split(s, ",")
+	if len(keys) > maxSortKeys {
+		return nil, fmt.Errorf("at most %d sort keys may be given", maxSortKeys)
+	}
+	var order []CompareFunc
+	for _, key := range keys {
+		reverse := strings.HasPrefix(key, "-")
+		cmp, ok := sortKeys[strings.TrimPrefix(key, "-")]
+		if !ok {
+			var valid []string
+			for k := range sortKeys {
+				valid = append(valid, k)
+			}
+			sort.Strings(valid)
+			return nil, fmt.Errorf("unknown sort key %q (valid keys: %s)", key, strings.Join(valid, ", "))
+		}
+		if reverse {
+			forward := cmp
+			cmp = func(a, b *Benchmark) int { return forward(b, a) }
+		}
+		order = append(order, cmp)
+	}
+	return order, nil
+}
+
+// sortLines orders g.Lines by the keys in order. Lines that compare equal on
+// every key keep their input order.
+func (g *BenchOutputGroup) sortLines(order []CompareFunc) {
+	if len(order) == 0 {
+		return
+	}
+	sort.SliceStable(g.Lines, func(i, j int) bool {
+		for _, cmp := range order {
+			if c := cmp(g.Lines[i], g.Lines[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,107 @@
+package format
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// benchSources maps benchmark function names to their "file:line"
+// locations. Keys are both "importpath.BenchmarkFoo" and "BenchmarkFoo".
+// It and benchSourcesErr are set by the first call of LoadBenchSources.
+var (
+	benchSourcesOnce sync.Once
+	benchSources     map[string]string
+	benchSourcesErr  error
+)
+
+var (
+	benchFuncMatcher = regexp.MustCompile(`^func (Benchmark\w*)\(`)
+	procsSuffix      = regexp.MustCompile(`-\d+$`)
+)
+
+// LoadBenchSources runs go list in the current directory and indexes the
+// benchmark functions declared in the test files of every package it
+// reports, for Options.ShowSource. Formatting with ShowSource calls it when
+// it needs the index, but it may be called earlier, such as in the
+// background while the input is read. Only the first call builds the index;
+// later ones wait for it and return the same error. If go list fails, the
+// index is left empty and the error is returned.
+func LoadBenchSources() error {
+	benchSourcesOnce.Do(func() {
+		benchSources = make(map[string]string)
+		benchSourcesErr = loadBenchSources(benchSources)
+	})
+	return benchSourcesErr
+}
+
+func loadBenchSources(index map[string]string) error {
+	out, err := exec.Command("go", "list", "-json", "./...").Output()
+	if err != nil {
+		return fmt.Errorf("go list failed: %s", err)
+	}
+	dec := json.NewDecoder(strings.NewReader(string(out)))
+	for dec.More() {
+		var pkg struct {
+			ImportPath   string
+			Dir          string
+			TestGoFiles  []string
+			XTestGoFiles []string
+			Module       *struct{ Dir string }
+		}
+		if err := dec.Decode(&pkg); err != nil {
+			return fmt.Errorf("cannot decode go list output: %s", err)
+		}
+		root := "."
+		if pkg.Module != nil {
+			root = pkg.Module.Dir
+		}
+		for _, file := range append(pkg.TestGoFiles, pkg.XTestGoFiles...) {
+			path := filepath.Join(pkg.Dir, file)
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				rel = path
+			}
+			indexBenchFuncs(index, path, rel, pkg.ImportPath)
+		}
+	}
+	return nil
+}
+
+func indexBenchFuncs(index map[string]string, path, rel, importPath string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if m := benchFuncMatcher.FindStringSubmatch(scanner.Text()); m != nil {
+			loc := fmt.Sprintf("%s:%d", rel, lineNum)
+			index[importPath+"."+m[1]] = loc
+			if _, ok := index[m[1]]; !ok {
+				index[m[1]] = loc
+			}
+		}
+	}
+}
+
+// benchSource returns the location of the function behind the benchmark
+// name (such as BenchmarkFoo/bar-8) in package pkg, or "" if it is unknown.
+func benchSource(pkg, name string) string {
+	LoadBenchSources()
+	funcName := procsSuffix.ReplaceAllString(name, "")
+	if i := strings.Index(funcName, "/"); i >= 0 {
+		funcName = funcName[:i]
+	}
+	if loc, ok := benchSources[pkg+"."+funcName]; ok {
+		return loc
+	}
+	return benchSources[funcName]
+}
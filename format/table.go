@@ -0,0 +1,451 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A TableStyle selects the characters that formatTableCells draws a table
+// with.
+type TableStyle int
+
+const (
+	// StylePlain separates cells with spaces and underlines the header with
+	// dashes.
+	StylePlain TableStyle = iota
+	// StyleBox draws a border of box-drawing characters around and between
+	// the cells.
+	StyleBox
+	// StyleCompact draws lines between the cells but no outer border.
+	StyleCompact
+)
+
+// ParseTableStyle parses a style name for Options.Style: plain, box, or
+// compact.
+func ParseTableStyle(s string) (TableStyle, error) {
+	switch s {
+	case "plain", "":
+		return StylePlain, nil
+	case "box":
+		return StyleBox, nil
+	case "compact":
+		return StyleCompact, nil
+	}
+	return 0, fmt.Errorf("unknown table style %q (valid styles: plain, box, compact)", s)
+}
+
+type Table struct {
+	MaxLengths []int
+	Cells      [][]string
+	// Number of rows at the end of Cells that summarize the rows above them
+	Summary int
+	// ANSI colors for the cells, parallel to Cells; nil or "" means uncolored
+	Colors [][]string
+}
+
+// findMaxLengths records the width of each column in runes, which is how fmt
+// measures padding.
+func (t *Table) findMaxLengths() {
+	t.MaxLengths = nil
+	for i := range t.Cells[0] {
+		maxLength := 0
+		for _, row := range t.Cells {
+			if n := utf8.RuneCountInString(row[i]); n > maxLength {
+				maxLength = n
+			}
+		}
+		t.MaxLengths = append(t.MaxLengths, maxLength)
+	}
+}
+
+// width returns the width of t as formatted by formatTableCells in style,
+// with plain columns separated by sep.
+func (t *Table) width(style TableStyle, sep string) int {
+	w := 0
+	for _, n := range t.MaxLengths {
+		w += n
+	}
+	if style == StylePlain {
+		w += utf8.RuneCountInString(sep) * (len(t.MaxLengths) - 1)
+	} else {
+		w += 3 * (len(t.MaxLengths) - 1)
+	}
+	if style == StyleBox {
+		w += 4 // "│ " and " │"
+	}
+	return w
+}
+
+// truncateNames shortens the cells of the first column to at most n
+// characters. A name that is too long loses its "Benchmark" prefix and then,
+// if it is still too long, its beginning, which is marked with an ellipsis:
+// names tend to share their beginnings and differ at their ends.
+func (t *Table) truncateNames(n int) {
+	for _, row := range t.Cells {
+		name := []rune(row[0])
+		if len(name) <= n {
+			continue
+		}
+		name = []rune(strings.TrimPrefix(row[0], "Benchmark"))
+		if len(name) > n {
+			name = append([]rune("…"), name[len(name)-(n-1):]...)
+		}
+		row[0] = string(name)
+	}
+	t.findMaxLengths()
+}
+
+// getFormat returns the fmt format for cell i of a row of n cells: the first
+// column is left-aligned and the rest are right-aligned, and all but the last
+// are followed by sep.
+func getFormat(i, n int, sep string) string {
+	sep = strings.ReplaceAll(sep, "%", "%%%%")
+	switch i {
+	case 0:
+		return "%%-%ds" + sep
+	case n - 1:
+		return "%%%ds"
+	default:
+		return "%%%ds" + sep
+	}
+}
+
+// formatTableCells renders t as the default aligned text table, with the
+// column names underlined if header is set. The columns are as wide either
+// way. In StylePlain, sep separates the columns.
+func (t *Table) formatTableCells(header bool, style TableStyle, sep string) string {
+	if style != StylePlain {
+		return t.formatRuledCells(header, style)
+	}
+	var underlines []string
+	for _, name := range t.Cells[0] {
+		underlines = append(underlines, strings.Repeat("-", utf8.RuneCountInString(name)))
+	}
+	var separators []string
+	for _, n := range t.MaxLengths {
+		separators = append(separators, strings.Repeat("-", n))
+	}
+
+	var buf bytes.Buffer
+	writeRow := func(row, colors []string) {
+		for i, cell := range row {
+			s := fmt.Sprintf(fmt.Sprintf(getFormat(i, len(row), sep), t.MaxLengths[i]), cell)
+			if i < len(colors) {
+				s = colorize(s, cell, colors[i])
+			}
+			buf.WriteString(s)
+		}
+		fmt.Fprint(&buf, "\n")
+	}
+	if header {
+		writeRow(t.Cells[0], nil)
+		writeRow(underlines, nil)
+	}
+	for r := 1; r < len(t.Cells); r++ {
+		if t.Summary > 0 && r == len(t.Cells)-t.Summary {
+			writeRow(separators, nil)
+		}
+		var colors []string
+		if r < len(t.Colors) {
+			colors = t.Colors[r]
+		}
+		writeRow(t.Cells[r], colors)
+	}
+	return buf.String()
+}
+
+// transpose swaps the rows and columns of t, so that the column names become
+// the first column. Summary rows become ordinary columns.
+func (t *Table) transpose() {
+	cells := make([][]string, len(t.Cells[0]))
+	var colors [][]string
+	for i := range cells {
+		cells[i] = make([]string, len(t.Cells))
+		for r, row := range t.Cells {
+			cells[i][r] = row[i]
+			if r < len(t.Colors) && i < len(t.Colors[r]) && t.Colors[r][i] != "" {
+				for len(colors) <= i {
+					colors = append(colors, nil)
+				}
+				for len(colors[i]) <= r {
+					colors[i] = append(colors[i], "")
+				}
+				colors[i][r] = t.Colors[r][i]
+			}
+		}
+	}
+	t.Cells, t.Colors, t.Summary = cells, colors, 0
+}
+
+// formatRuledCells renders t like formatTableCells, but with box-drawing
+// lines between the cells and, in StyleBox, around them.
+func (t *Table) formatRuledCells(header bool, style TableStyle) string {
+	var buf bytes.Buffer
+	border := style == StyleBox
+	rule := func(left, middle, right string) {
+		var parts []string
+		for _, n := range t.MaxLengths {
+			parts = append(parts, strings.Repeat("─", n))
+		}
+		if !border {
+			left, right = "", ""
+		}
+		buf.WriteString(left + strings.Join(parts, "─"+middle+"─") + right + "\n")
+	}
+	writeRow := func(row, colors []string) {
+		var cells []string
+		for i, cell := range row {
+			format := "%*s"
+			if i == 0 {
+				format = "%-*s"
+			}
+			s := fmt.Sprintf(format, t.MaxLengths[i], cell)
+			if i < len(colors) {
+				s = colorize(s, cell, colors[i])
+			}
+			cells = append(cells, s)
+		}
+		line := strings.Join(cells, " │ ")
+		if border {
+			line = "│ " + line + " │"
+		}
+		buf.WriteString(line + "\n")
+	}
+	if border {
+		rule("┌─", "┬", "─┐")
+	}
+	if header {
+		writeRow(t.Cells[0], nil)
+		rule("├─", "┼", "─┤")
+	}
+	for r := 1; r < len(t.Cells); r++ {
+		if t.Summary > 0 && r == len(t.Cells)-t.Summary {
+			rule("├─", "┼", "─┤")
+		}
+		var colors []string
+		if r < len(t.Colors) {
+			colors = t.Colors[r]
+		}
+		writeRow(t.Cells[r], colors)
+	}
+	if border {
+		rule("└─", "┴", "─┘")
+	}
+	return buf.String()
+}
+
+// setColor sets the color of cell i of row r.
+func (t *Table) setColor(r, i int, color string) {
+	for len(t.Colors) <= r {
+		t.Colors = append(t.Colors, nil)
+	}
+	for len(t.Colors[r]) <= i {
+		t.Colors[r] = append(t.Colors[r], "")
+	}
+	t.Colors[r][i] = color
+}
+
+// writePipeRow writes row with its cells padded to the column widths and
+// delimited by '|'.
+func (t *Table) writePipeRow(buf *bytes.Buffer, row []string) {
+	for i, cell := range row {
+		format := "| %*s "
+		if i == 0 {
+			format = "| %-*s "
+		}
+		fmt.Fprintf(buf, format, t.MaxLengths[i], cell)
+	}
+	fmt.Fprint(buf, "|\n")
+}
+
+// formatRST renders t as a reStructuredText grid table.
+func (t *Table) formatRST() string {
+	var buf bytes.Buffer
+	border := func(c string) {
+		for _, n := range t.MaxLengths {
+			fmt.Fprintf(&buf, "+%s", strings.Repeat(c, n+2))
+		}
+		fmt.Fprint(&buf, "+\n")
+	}
+	border("-")
+	for r, row := range t.Cells {
+		t.writePipeRow(&buf, row)
+		if r == 0 {
+			border("=")
+		} else {
+			border("-")
+		}
+	}
+	return buf.String()
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+	`μ`, `\textmu{}`,
+	`×`, `\texttimes{}`,
+)
+
+// formatLaTeX renders t as a LaTeX tabular environment. The numeric columns
+// use the siunitx S column type; a unit shared by every cell of a column is
+// moved into its header so that the cells hold plain numbers. If booktabs
+// is set, the rules come from the booktabs package instead of \hline.
+func (t *Table) formatLaTeX(booktabs bool) string {
+	top, mid, bottom := `\hline`, `\hline`, `\hline`
+	if booktabs {
+		top, mid, bottom = `\toprule`, `\midrule`, `\bottomrule`
+	}
+	ncols := len(t.Cells[0])
+	rows := make([][]string, len(t.Cells))
+	for r := range rows {
+		rows[r] = make([]string, ncols)
+	}
+	for i := 0; i < ncols; i++ {
+		if i == 0 {
+			for r, row := range t.Cells {
+				rows[r][i] = latexEscaper.Replace(row[i])
+			}
+			continue
+		}
+		unit := columnUnit(t.Cells[1:], i)
+		header := t.Cells[0][i]
+		if unit != "" {
+			header += " (" + unit + ")"
+		}
+		rows[0][i] = "{" + latexEscaper.Replace(header) + "}"
+		for r, row := range t.Cells[1:] {
+			cell := row[i]
+			if unit != "" {
+				cell = strings.TrimSuffix(cell, " "+unit)
+			}
+			if _, err := strconv.ParseFloat(cell, 64); err != nil && cell != "" {
+				cell = "{" + latexEscaper.Replace(cell) + "}"
+			}
+			rows[r+1][i] = cell
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\\begin{tabular}{l%s}\n", strings.Repeat("S", ncols-1))
+	fmt.Fprintln(&buf, top)
+	for r, row := range rows {
+		fmt.Fprintf(&buf, "%s \\\\\n", strings.Join(row, " & "))
+		if r == 0 {
+			fmt.Fprintln(&buf, mid)
+		}
+	}
+	fmt.Fprintln(&buf, bottom)
+	fmt.Fprintln(&buf, `\end{tabular}`)
+	return buf.String()
+}
+
+// columnUnit returns the unit that follows the number in every non-empty
+// cell of column i, or "" if the cells do not share one.
+func columnUnit(rows [][]string, i int) string {
+	var unit string
+	for _, row := range rows {
+		if row[i] == "" {
+			continue
+		}
+		j := strings.LastIndex(row[i], " ")
+		if j < 0 {
+			return ""
+		}
+		if _, err := strconv.ParseFloat(row[i][:j], 64); err != nil {
+			return ""
+		}
+		if unit != "" && unit != row[i][j+1:] {
+			return ""
+		}
+		unit = row[i][j+1:]
+	}
+	return unit
+}
+
+// formatOrg renders t as an Emacs org-mode table, preceded by a caption and
+// the column alignments.
+func (t *Table) formatOrg(caption string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#+CAPTION: %s\n", caption)
+	alignments := []string{"left"}
+	for range t.Cells[0][1:] {
+		alignments = append(alignments, "right")
+	}
+	fmt.Fprintf(&buf, "#+ATTR_ORG: :alignment (%s)\n", strings.Join(alignments, " "))
+	for r, row := range t.Cells {
+		t.writePipeRow(&buf, row)
+		if r == 0 {
+			for i, n := range t.MaxLengths {
+				sep := "+"
+				if i == 0 {
+					sep = "|"
+				}
+				fmt.Fprintf(&buf, "%s%s", sep, strings.Repeat("-", n+2))
+			}
+			fmt.Fprint(&buf, "|\n")
+		}
+	}
+	return buf.String()
+}
+
+// formatCSV renders t as CSV, with the column names as the first record.
+func (t *Table) formatCSV() string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(t.Cells) // writes to a bytes.Buffer cannot fail
+	return buf.String()
+}
+
+var tsvEscaper = strings.NewReplacer("\t", " ", "\n", " ")
+
+// formatTSV renders t as tab-separated values, without quoting. Tabs and
+// newlines in cells become spaces.
+func (t *Table) formatTSV() string {
+	var buf bytes.Buffer
+	for _, row := range t.Cells {
+		for i, cell := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(tsvEscaper.Replace(cell))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+var markdownEscaper = strings.NewReplacer(`|`, `\|`)
+
+// formatMarkdown renders t as a GitHub-flavored Markdown pipe table.
+func (t *Table) formatMarkdown() string {
+	var buf bytes.Buffer
+	for r, row := range t.Cells {
+		for _, cell := range row {
+			fmt.Fprintf(&buf, "| %s ", markdownEscaper.Replace(cell))
+		}
+		fmt.Fprint(&buf, "|\n")
+		if r == 0 {
+			for i := range row {
+				align := "---:"
+				if i == 0 {
+					align = ":---"
+				}
+				fmt.Fprintf(&buf, "| %s ", align)
+			}
+			fmt.Fprint(&buf, "|\n")
+		}
+	}
+	return buf.String()
+}
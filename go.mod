@@ -1,5 +1,5 @@
 module github.com/cespare/prettybench
 
-go 1.17
+go 1.18
 
 require golang.org/x/tools v0.1.5
@@ -1,198 +1,569 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
-	"time"
 
-	"golang.org/x/tools/benchmark/parse"
+	"github.com/cespare/prettybench/format"
 )
 
-var noPassthrough = flag.Bool("no-passthrough", false, "Don't print non-benchmark lines")
+var (
+	noPassthrough passthroughMode
+	filters       stringList
+	inputFile     = flag.String("input", "", "Read benchmark output from this file (further files may be given as arguments)")
+	readStdin     = flag.Bool("stdin", false, "Read benchmark output from stdin (implied when stdin is not a terminal)")
+	outputFormat  = flag.String("format", "table", "Output format: table, json, csv, tsv, markdown, rst, latex, org, sparkline, ndjson, junit, or prometheus")
+	latexBooktabs = flag.Bool("latex-booktabs", false, "Use booktabs rules in -format=latex output")
+	showPackage   = flag.Bool("show-package", false, "Show the package path from each group's ok line above its table")
+	showGoVersion = flag.Bool("show-go-version", false, "Show the Go version reported in the benchmark output above each table (a go_version field in json output)")
+	precision     = flag.Int("precision", format.DefaultPrecision, "Number of decimal places of times, throughputs, and other fractional values")
+	trimZeros     = flag.Bool("trim-trailing-zeros", false, "Drop insignificant trailing zeros from times and throughputs")
+	sortBy        = flag.String("sort", "", "Sort benchmarks within each group by up to three comma-separated keys (name, name-length, iter, time, throughput or mb, bytes, allocs); prefix a key with - to reverse it")
+	annotatePct   = flag.Bool("annotate-percentile", false, "Append each benchmark's percentile rank by time within its group to its name (a percentile_rank field in json, csv, and tsv output)")
+	multiInvoke   = flag.Bool("multi-invocation", false, "Split input at repeated goos/goarch/pkg/cpu prologues and show each prologue above its table")
+	benchTimeout  = flag.Duration("benchmark-timeout", 0, "Only show benchmarks until their cumulative run time (N * ns/op) in a group exceeds this budget")
+	relMedian     = flag.Bool("relative-to-median", false, "Add a column showing each time as a multiple of the group's median time")
+	abbrevNames   = flag.Bool("abbrev-names", false, "Abbreviate benchmark names to their initials and print a legend below the table")
+	showRaw       = flag.Bool("show-raw", false, "Print each parsed benchmark struct to stderr")
+	showSource    = flag.Bool("show-source", false, "Append the source location of each benchmark (found with go list) to its name")
+	combinePkgs   = flag.Bool("combine-packages", false, "Print a single table of times for all packages, with one column per package")
+	minMBPerS     = flag.Float64("min-mb", 0, "Drop benchmarks whose throughput is below this many MB/s")
+	maxMBPerS     = flag.Float64("max-mb", 0, "Drop benchmarks whose throughput is above this many MB/s")
+	showImprove   = flag.Bool("show-improvement-pct", false, "If a group starts with its baseline benchmark, add a column showing each benchmark's time improvement over it")
+	baselineName  = flag.String("baseline", "BenchmarkBaseline", "Name (without the -GOMAXPROCS suffix) of the baseline benchmark for -show-improvement-pct")
+	mergeSameName = flag.Bool("merge-same-name", false, "With several input files, also compare the times of each package found in more than one file side by side")
+	timeScale     = flag.Float64("scale", 1, "Multiply every ns/op value by this factor before formatting")
+	emitRaw       = flag.Bool("emit-bench-format", false, "Print the remaining benchmarks in go test's own format instead of a table")
+	checkCPU      = flag.Bool("check-cpu", false, "Warn when the benchmarks in a group ran with different GOMAXPROCS values")
+	exclude       = flag.String("exclude", "", "Drop benchmarks whose name matches this regular expression, even if they match -filter")
+	minIters      = flag.Int("count-threshold", 0, "Drop benchmarks that ran fewer than this many iterations")
+	minNsPerOp    = flag.Float64("min-ns-per-op", 0, "Drop benchmarks faster than this many ns/op, whose times are mostly measurement noise")
+	noBenchPrefix = flag.Bool("no-bench-prefix", false, "Strip the leading \"Benchmark\" from names in the table")
+	timeUnit      = flag.String("time-unit", "auto", "Unit for times: ns, us, ms, s, or auto to pick one per group from its smallest time")
+	compareFile   = flag.String("compare", "", "Compare against the baseline benchmark output in this file, adding time and alloc delta columns")
+	showGeomean   = flag.Bool("geomean", false, "Add a row with the geometric mean of the times and allocations in each group")
+	showSummary   = flag.Bool("summary", false, "Add min, mean, and max rows for the times and allocations in each group")
+	colorMode     = flag.String("color", "auto", "Color the fastest and slowest quartile of times: always, never, or auto to color only when stdout is a terminal and NO_COLOR is unset")
+	opsPerSec     = flag.Bool("ops-per-sec", false, "Show operations per second instead of the time per operation")
+	aggregateBy   = flag.String("aggregate", "", "Collapse repeated runs of a benchmark in a group (as from -count) into one row using min, mean, or max")
+	stripPrefix   = flag.Bool("strip-common-prefix", false, "Remove the longest prefix shared by the benchmark names of a group (after \"Benchmark\") and show it above the table")
+	showProcs     = flag.Bool("show-procs", false, "Show the GOMAXPROCS suffix of benchmark names in a column of its own (always shown for groups that ran with several values)")
+	groupSubs     = flag.Bool("group-sub-benchmarks", false, "Sort sub-benchmarks by their parent and list them under a row naming it")
+	top           = flag.Int("top", 0, "Only show the N fastest benchmarks of each group, or the first N in the -sort order (so -sort=-time -top=N shows the slowest)")
+	humanBytes    = flag.Bool("human-bytes", false, "Show allocation sizes of 1024 bytes or more in KB, MB, and so on")
+	iecBytes      = flag.Bool("iec-bytes", false, "Show allocation sizes of 1024 bytes or more in KiB, MiB, and so on")
+	humanIters    = flag.Bool("human-iters", false, "Show iteration counts with K, M, and G suffixes, as in 1.5M")
+	thousandsSep  = flag.Bool("thousands-sep", false, "Separate groups of three digits in iteration counts with -sep-char")
+	sepChar       = flag.String("sep-char", ",", "Digit group separator for -thousands-sep")
+	colorLimit    = flag.Duration("color-threshold", 0, "With -color, color times above this duration (such as 1ms) red and the rest green")
+	percentiles   = flag.String("percentile", "", "Collapse repeated runs of a benchmark in a group into a row per comma-separated percentile, such as 50,95,99")
+	showCV        = flag.Bool("show-cv", false, "With -aggregate, add a column with the coefficient of variation of each benchmark's run times")
+	cvYellow      = flag.Float64("cv-yellow", 5, "With -show-cv and -color, color coefficients of variation above this percentage yellow")
+	cvRed         = flag.Float64("cv-red", 20, "With -show-cv and -color, color coefficients of variation above this percentage red")
+	showOpsSec    = flag.Bool("show-ops-sec", false, "Add a column with the operations per second of each benchmark after the times")
+	rank          = flag.Bool("rank", false, "Add a column ranking the benchmarks of each group by time (#1 is the fastest)")
+	normalize     = flag.String("normalize", "", "Add a ratio column with each time relative to the first benchmark of its group (first) or the fastest one (min)")
+	colSep        = flag.String("col-sep", "   ", "Separator between the columns of plain tables")
+	tableStyle    = flag.String("style", "plain", "Table style: plain, box (box-drawing borders), or compact (lines between columns only)")
+	totalAllocs   = flag.Bool("show-total-allocs", false, "Add columns with the bytes and allocations of all the iterations of each benchmark")
+	transpose     = flag.Bool("transpose", false, "Lay out tables with a column per benchmark and a row per metric")
+	noGroupSep    = flag.Bool("no-group-separator", false, "Don't print a blank line between the tables of successive groups")
+	noCaption     = flag.Bool("no-caption", false, "Don't print the goos, goarch, and cpu of the benchmarks above tables")
+	noHeader      = flag.Bool("no-header", false, "Don't print the column names and their underlines above tables")
+	maxNameWidth  = flag.Int("max-name-width", 0, "Truncate benchmark names in tables to this many characters (default: fit tables to the terminal width, if stdout is one)")
+	githubSummary = flag.Bool("github-summary", false, "Also append each table in Markdown to the GitHub Actions step summary ($GITHUB_STEP_SUMMARY)")
+	nameWidth     = flag.Int("name-width", 0, "Make the benchmark name column of tables exactly this wide, padding or truncating names")
+	outputFile    = flag.String("o", "", "Write the formatted benchmarks to this file instead of stdout (other lines still go to stdout)")
+	showVersion   = flag.Bool("version", false, "Print the prettybench version and exit")
+	columns       = flag.String("columns", "", "Comma-separated list of table columns to show, in order (benchmark, rank, procs, iter, time/iter, ops/sec, cv, ratio, median, improvement, throughput, bytes, allocs, total B, total allocs, delta time, delta allocs, or a custom unit)")
+	runBench      = flag.String("run-bench", "", "Run go test -bench with this pattern in the current directory and format its output")
+	benchTime     = flag.String("benchtime", "", "The -benchtime to pass to go test with -run-bench")
+	benchMem      = flag.Bool("benchmem", false, "Pass -benchmem to go test with -run-bench")
+	benchCount    = flag.Int("count", 0, "The -count to pass to go test with -run-bench")
+	benchCPU      = flag.String("cpu", "", "The -cpu list to pass to go test with -run-bench")
+	rawInput      = flag.Bool("raw", false, "Don't check whether the input is already prettybench output; only parse go test lines")
+	maxGroups     = flag.Int("max-groups", 0, "Stop after printing this many benchmark groups (0 means no limit)")
+	verbosity     verbosityLevel
+)
 
-type BenchOutputGroup struct {
-	Lines []*parse.Benchmark
-	// Columns which are in use
-	Measured int
-}
+// opts holds the formatting flags.
+var opts format.Options
+
+// out receives the formatted benchmarks: stdout, or the -o file. Other
+// lines are always passed through to stdout.
+var out = os.Stdout
 
-type Table struct {
-	MaxLengths []int
-	Cells      [][]string
+// summary is the GitHub Actions step summary file that -github-summary
+// appends Markdown tables to, if any.
+var summary *os.File
+
+func init() {
+	flag.Var(&noPassthrough, "no-passthrough", "Don't print non-benchmark lines (auto: only once a group has benchmark lines, still printing ok and FAIL lines)")
+	flag.Var(&filters, "filter", "Only show benchmarks whose name, or sub-benchmark suffix, matches this regular expression (may be repeated to show benchmarks matching any of them)")
+	flag.Var(&verbosity, "v", "Print parsing debug information to stderr (1: group events, 2: line events)")
+	flag.Var(&verbosity, "verbose", "Alias for -v")
 }
 
-func (g *BenchOutputGroup) String() string {
-	if len(g.Lines) == 0 {
-		return ""
-	}
-	columnNames := []string{"benchmark", "iter", "time/iter"}
-	if (g.Measured & parse.MBPerS) > 0 {
-		columnNames = append(columnNames, "throughput")
-	}
-	if (g.Measured & parse.AllocedBytesPerOp) > 0 {
-		columnNames = append(columnNames, "bytes alloc")
-	}
-	if (g.Measured & parse.AllocsPerOp) > 0 {
-		columnNames = append(columnNames, "allocs")
-	}
-	table := &Table{Cells: [][]string{columnNames}}
+// verbosityLevel is a flag.Value that may be given as a bare boolean flag
+// (-v, meaning level 1) or with an explicit level (-v=2).
+type verbosityLevel int
 
-	var underlines []string
-	for _, name := range columnNames {
-		underlines = append(underlines, strings.Repeat("-", len(name)))
-	}
-	table.Cells = append(table.Cells, underlines)
-	timeFormatFunc := g.TimeFormatFunc()
+func (v *verbosityLevel) String() string { return strconv.Itoa(int(*v)) }
 
-	for _, line := range g.Lines {
-		row := []string{line.Name, FormatIterations(line.N), timeFormatFunc(line.NsPerOp)}
-		if (g.Measured & parse.MBPerS) > 0 {
-			row = append(row, FormatMegaBytesPerSecond(line))
-		}
-		if (g.Measured & parse.AllocedBytesPerOp) > 0 {
-			row = append(row, FormatBytesAllocPerOp(line))
-		}
-		if (g.Measured & parse.AllocsPerOp) > 0 {
-			row = append(row, FormatAllocsPerOp(line))
-		}
-		table.Cells = append(table.Cells, row)
+func (v *verbosityLevel) Set(s string) error {
+	switch s {
+	case "true":
+		*v = 1
+		return nil
+	case "false":
+		*v = 0
+		return nil
 	}
-	for i := range columnNames {
-		maxLength := 0
-		for _, row := range table.Cells {
-			if len(row[i]) > maxLength {
-				maxLength = len(row[i])
-			}
-		}
-		table.MaxLengths = append(table.MaxLengths, maxLength)
-	}
-	var buf bytes.Buffer
-	for _, row := range table.Cells {
-		for i, cell := range row {
-			var format string
-			switch i {
-			case 0:
-				format = "%%-%ds   "
-			case len(row) - 1:
-				format = "%%%ds"
-			default:
-				format = "%%%ds   "
-			}
-			fmt.Fprintf(&buf, fmt.Sprintf(format, table.MaxLengths[i]), cell)
-		}
-		fmt.Fprint(&buf, "\n")
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return errors.New("verbosity must be a non-negative integer")
 	}
-	return buf.String()
+	*v = verbosityLevel(n)
+	return nil
 }
 
-func FormatIterations(iter int) string {
-	return strconv.FormatInt(int64(iter), 10)
+func (v *verbosityLevel) IsBoolFlag() bool { return true }
+
+// stringList is a flag.Value that collects the values of a flag given more
+// than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
 }
 
-func (g *BenchOutputGroup) TimeFormatFunc() func(float64) string {
-	// Find the smallest time
-	smallest := g.Lines[0].NsPerOp
-	for _, line := range g.Lines[1:] {
-		if line.NsPerOp < smallest {
-			smallest = line.NsPerOp
-		}
+// passthroughMode is the value of -no-passthrough: "true", "false", or
+// "auto". A bare -no-passthrough means "true".
+type passthroughMode string
+
+func (m *passthroughMode) String() string {
+	if *m == "" {
+		return "false"
 	}
-	switch {
-	case smallest < float64(10000*time.Nanosecond):
-		return func(ns float64) string {
-			return fmt.Sprintf("%.2f ns/op", ns)
-		}
-	case smallest < float64(time.Millisecond):
-		return func(ns float64) string {
-			return fmt.Sprintf("%.2f μs/op", ns/1000)
-		}
-	case smallest < float64(10*time.Second):
-		return func(ns float64) string {
-			return fmt.Sprintf("%.2f ms/op", (ns / 1e6))
-		}
+	return string(*m)
+}
+
+func (m *passthroughMode) Set(s string) error {
+	switch s {
+	case "auto":
+	case "1", "t", "T", "true", "TRUE", "True":
+		s = "true"
+	case "0", "f", "F", "false", "FALSE", "False":
+		s = "false"
 	default:
-		return func(ns float64) string {
-			return fmt.Sprintf("%.2f s/op", ns/1e9)
-		}
+		return errors.New(`must be a boolean or "auto"`)
 	}
+	*m = passthroughMode(s)
+	return nil
 }
 
-func FormatMegaBytesPerSecond(l *parse.Benchmark) string {
-	if (l.Measured & parse.MBPerS) == 0 {
-		return ""
+func (m *passthroughMode) IsBoolFlag() bool { return true }
+
+// suppress reports whether a non-benchmark line should be dropped while g
+// is being collected.
+func (m passthroughMode) suppress(g *format.BenchOutputGroup) bool {
+	switch m {
+	case "true":
+		return true
+	case "auto":
+		return len(g.Lines) > 0
 	}
-	return fmt.Sprintf("%.2f MB/s", l.MBPerS)
+	return false
 }
 
-func FormatBytesAllocPerOp(l *parse.Benchmark) string {
-	if (l.Measured & parse.AllocedBytesPerOp) == 0 {
-		return ""
-	}
-	return fmt.Sprintf("%d B/op", l.AllocedBytesPerOp)
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func FormatAllocsPerOp(l *parse.Benchmark) string {
-	if (l.Measured & parse.AllocsPerOp) == 0 {
-		return ""
+// printVersion prints the module version, Go version, and VCS revision
+// recorded in the binary. Binaries built from a checkout with go build have
+// no module version and are reported as dev builds.
+func printVersion() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Println("prettybench dev build")
+		return
+	}
+	version := info.Main.Version
+	if version == "" || version == "(devel)" {
+		version = "dev build"
+	}
+	fmt.Println("prettybench", version)
+	fmt.Println("go:", info.GoVersion)
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			fmt.Println("revision:", s.Value)
+		}
 	}
-	return fmt.Sprintf("%d allocs/op", l.AllocsPerOp)
 }
 
-func (g *BenchOutputGroup) AddLine(line *parse.Benchmark) {
-	g.Lines = append(g.Lines, line)
-	g.Measured |= line.Measured
+// debugf prints a debug message to stderr if the verbosity is at least level.
+func debugf(level int, format string, args ...interface{}) {
+	if int(verbosity) < level {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "prettybench: "+format+"\n", args...)
 }
 
 var (
-	benchLineMatcher = regexp.MustCompile(`^Benchmark.*\t.*\d+`)
-	okLineMatcher    = regexp.MustCompile(`^ok\s`)
-	errNotBenchLine  = errors.New("not a bench line")
+	prologueMatcher  = regexp.MustCompile(`^(goos|goarch|pkg|cpu): `)
+	goVersionMatcher = regexp.MustCompile(`^go test: (go\d+\.\d+(?:\.\d+)?)`)
+	// failLineMatcher matches the FAIL lines go test prints for a failed
+	// package, which -no-passthrough=auto keeps like ok lines.
+	failLineMatcher = regexp.MustCompile(`^FAIL\b`)
+	// tableHeaderMatcher and tableRuleMatcher match the first two lines of
+	// a table printed by prettybench itself.
+	tableHeaderMatcher = regexp.MustCompile(`^benchmark {2,}\S`)
+	tableRuleMatcher   = regexp.MustCompile(`^-+( +-+)*$`)
+	// forwardMatcher matches the lines that are printed even with
+	// -no-passthrough: the "# package" heading of go vet or build errors,
+	// their file:line diagnostics, and test results.
+	forwardMatcher = regexp.MustCompile(`^(# |\s*--- (FAIL|PASS)|\S+\.go:\d+)`)
+)
+
+// filterRegexps and excludeRegexp are the compiled -filter and -exclude
+// patterns, if any.
+var (
+	filterRegexps []*regexp.Regexp
+	excludeRegexp *regexp.Regexp
 )
 
-func ParseLine(line string) (*parse.Benchmark, error) {
-	if !benchLineMatcher.MatchString(line) {
-		return nil, errNotBenchLine
+// selected reports whether the benchmark line passes -filter and -exclude:
+// its name must match one of the -filter patterns, if any, and not the
+// -exclude one. A sub-benchmark such as BenchmarkFoo/bar also passes -filter
+// if its /bar suffix matches. Names are matched both with and without their
+// -GOMAXPROCS suffix, as they are shown in tables. -exclude takes
+// precedence: a name it matches is never selected.
+func selected(line *format.Benchmark) bool {
+	names := []string{line.Name}
+	if base := line.BaseName(); base != line.Name {
+		names = append(names, base)
 	}
-	fields := strings.Split(line, "\t")
-	if len(fields) < 3 {
-		return nil, errNotBenchLine
+	for _, name := range names {
+		if excludeRegexp != nil && excludeRegexp.MatchString(name) {
+			return false
+		}
 	}
+	if len(filterRegexps) == 0 {
+		return true
+	}
+	for _, re := range filterRegexps {
+		for _, name := range names {
+			if re.MatchString(name) {
+				return true
+			}
+			if i := strings.Index(name, "/"); i >= 0 && (re.MatchString(name[i:]) || re.MatchString(name[i+1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	return parse.ParseLine(line)
+// isTerminal reports whether f is attached to a terminal rather than a pipe
+// or a file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// heading prints a heading line, such as the name of an input file, above
+// the tables that follow, separated by a blank line from any output above
+// it if sep is set. Formats whose output isn't free text, such as JSON and
+// CSV, would be broken by the line, so it goes to stderr instead.
+func heading(line string, sep bool) {
+	switch *outputFormat {
+	case "table", "markdown", "rst", "org", "sparkline":
+	default:
+		fmt.Fprintln(os.Stderr, "prettybench:", line)
+		return
+	}
+	if sep {
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out, line)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go test -bench . | prettybench [flags]")
+	fmt.Fprintln(os.Stderr, "       prettybench [flags] file...")
+	flag.PrintDefaults()
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
-	currentBenchmark := &BenchOutputGroup{}
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		text := scanner.Text()
-		line, err := ParseLine(text)
-		switch err {
-		case errNotBenchLine:
-			if okLineMatcher.MatchString(text) {
-				fmt.Print(currentBenchmark)
-				currentBenchmark = &BenchOutputGroup{}
+	if *showVersion {
+		printVersion()
+		return
+	}
+	// TSV is meant for pasting into spreadsheets, so it leaves out other
+	// lines unless -no-passthrough says otherwise.
+	if *outputFormat == "tsv" && !flagSet("no-passthrough") {
+		noPassthrough = "true"
+	}
+	if !*readStdin && !isTerminal(os.Stdin) {
+		*readStdin = true
+	}
+	files := flag.Args()
+	if *inputFile != "" {
+		files = append([]string{*inputFile}, files...)
+	}
+	if len(files) == 0 && !*readStdin && *runBench == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch *outputFormat {
+	case "table", "json", "csv", "tsv", "markdown", "rst", "latex", "org", "sparkline", "ndjson", "junit", "prometheus":
+	default:
+		fmt.Fprintf(os.Stderr, "prettybench: unknown -format %q\n", *outputFormat)
+		os.Exit(2)
+	}
+	// The combined table has no form in the formats that aren't tables.
+	switch *outputFormat {
+	case "json", "ndjson", "junit", "prometheus", "sparkline":
+		if *combinePkgs {
+			fmt.Fprintf(os.Stderr, "prettybench: -combine-packages can't be used with -format=%s\n", *outputFormat)
+			os.Exit(2)
+		}
+	}
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "prettybench:", err)
+			os.Exit(1)
+		}
+		out = f
+	}
+	if *githubSummary {
+		if path := os.Getenv("GITHUB_STEP_SUMMARY"); path == "" {
+			fmt.Fprintln(os.Stderr, "prettybench: -github-summary: GITHUB_STEP_SUMMARY is not set; not writing a summary")
+		} else {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "prettybench:", err)
+				os.Exit(1)
 			}
-			if !*noPassthrough {
-				fmt.Println(text)
+			summary = f
+		}
+	}
+	switch *colorMode {
+	case "always":
+		opts.Color = true
+	case "never":
+	case "auto":
+		opts.Color = isTerminal(out) && os.Getenv("NO_COLOR") == ""
+	default:
+		fmt.Fprintf(os.Stderr, "prettybench: unknown -color %q\n", *colorMode)
+		os.Exit(2)
+	}
+	switch *timeUnit {
+	case "auto", "ns", "us", "ms", "s":
+	default:
+		fmt.Fprintf(os.Stderr, "prettybench: unknown -time-unit %q\n", *timeUnit)
+		os.Exit(2)
+	}
+	switch *normalize {
+	case "", "first", "min":
+	default:
+		fmt.Fprintf(os.Stderr, "prettybench: unknown -normalize %q\n", *normalize)
+		os.Exit(2)
+	}
+	for _, pattern := range filters {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "prettybench: bad -filter:", err)
+			os.Exit(1)
+		}
+		filterRegexps = append(filterRegexps, re)
+	}
+	if *exclude != "" {
+		var err error
+		if excludeRegexp, err = regexp.Compile(*exclude); err != nil {
+			fmt.Fprintln(os.Stderr, "prettybench: bad -exclude:", err)
+			os.Exit(1)
+		}
+	}
+	var err error
+	if opts.Sort, err = format.ParseSort(*sortBy); err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: bad -sort:", err)
+		os.Exit(2)
+	}
+	if opts.Aggregate, err = format.ParseAggregate(*aggregateBy); err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: bad -aggregate:", err)
+		os.Exit(2)
+	}
+	if opts.Columns, err = format.ParseColumns(*columns); err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: bad -columns:", err)
+		os.Exit(2)
+	}
+	if opts.Style, err = format.ParseTableStyle(*tableStyle); err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: bad -style:", err)
+		os.Exit(2)
+	}
+	if opts.Percentiles, err = format.ParsePercentiles(*percentiles); err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: bad -percentile:", err)
+		os.Exit(2)
+	}
+	if opts.Aggregate != nil && opts.Percentiles != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: -aggregate and -percentile can't be used together")
+		os.Exit(2)
+	}
+	if *compareFile != "" {
+		if opts.Compare, err = format.LoadCompareFile(*compareFile, &opts); err != nil {
+			fmt.Fprintln(os.Stderr, "prettybench:", err)
+			os.Exit(1)
+		}
+	}
+	opts.Format = *outputFormat
+	opts.LaTeXBooktabs = *latexBooktabs
+	opts.ShowPackage = *showPackage
+	opts.ShowGoVersion = *showGoVersion
+	opts.TrimTrailingZeros = *trimZeros
+	if *precision < 0 {
+		fmt.Fprintln(os.Stderr, "prettybench: -precision must not be negative")
+		os.Exit(2)
+	}
+	opts.Precision = *precision
+	opts.AnnotatePercentile = *annotatePct
+	opts.BenchmarkTimeout = *benchTimeout
+	opts.RelativeToMedian = *relMedian
+	opts.AbbrevNames = *abbrevNames
+	opts.ShowSource = *showSource
+	opts.MinMBPerS = *minMBPerS
+	opts.MaxMBPerS = *maxMBPerS
+	opts.ShowImprovementPct = *showImprove
+	opts.Baseline = *baselineName
+	opts.Scale = *timeScale
+	opts.EmitBenchFormat = *emitRaw
+	opts.NoBenchPrefix = *noBenchPrefix
+	opts.TimeUnit = *timeUnit
+	opts.Geomean = *showGeomean
+	opts.Summary = *showSummary
+	opts.OpsPerSec = *opsPerSec
+	opts.StripCommonPrefix = *stripPrefix
+	opts.ShowProcs = *showProcs
+	opts.GroupSubBenchmarks = *groupSubs
+	opts.Top = *top
+	opts.HumanBytes = *humanBytes
+	opts.IECBytes = *iecBytes
+	opts.HumanIters = *humanIters
+	if *thousandsSep {
+		opts.ThousandsSep = *sepChar
+	}
+	opts.NoHeader = *noHeader
+	// The same problem tends to recur in every group, so each warning is
+	// only printed once.
+	warned := make(map[string]bool)
+	opts.Warn = func(msg string) {
+		if !warned[msg] {
+			warned[msg] = true
+			fmt.Fprintln(os.Stderr, "prettybench:", msg)
+		}
+	}
+	opts.ColorThreshold = *colorLimit
+	opts.ShowCV = *showCV
+	opts.CVYellow = *cvYellow
+	opts.CVRed = *cvRed
+	opts.ShowOpsSec = *showOpsSec
+	opts.Rank = *rank
+	opts.ColSep = *colSep
+	opts.Normalize = *normalize
+	opts.ShowTotalAllocs = *totalAllocs
+	opts.Transpose = *transpose
+	opts.NoCaption = *noCaption
+	opts.MaxNameWidth = *maxNameWidth
+	opts.NameWidth = *nameWidth
+	// Names are only truncated to fit a terminal; piped output and -o
+	// files keep them whole unless -max-name-width says otherwise.
+	if w, ok := terminalWidth(out); ok {
+		opts.Width = w
+	}
+	if *showSource {
+		go func() {
+			if err := format.LoadBenchSources(); err != nil {
+				debugf(1, "not showing benchmark sources: %s", err)
 			}
-		case nil:
-			currentBenchmark.AddLine(line)
-		default:
-			fmt.Fprintln(os.Stderr, "prettybench unrecognized line:")
-			fmt.Println(text)
+		}()
+	}
+	if *outputFormat == "junit" {
+		fmt.Fprint(out, xml.Header)
+		fmt.Fprintln(out, "<testsuites>")
+	}
+	p := &processor{}
+	var testErr error
+	if *runBench != "" {
+		testErr = p.runGoTest()
+	} else if len(files) == 0 {
+		p.run(os.Stdin, "")
+	}
+	for i, name := range files {
+		if p.limitReached() {
+			break
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "prettybench:", err)
+			os.Exit(1)
+		}
+		// With several files, a heading says which results came from
+		// which.
+		if len(files) > 1 {
+			heading(fmt.Sprintf("# file: %s", name), i > 0)
 		}
+		p.run(f, name)
+		f.Close()
+	}
+	if len(p.metrics) > 0 {
+		fmt.Fprint(out, format.Format(p.metrics, opts))
+	}
+	if len(p.combined) > 0 {
+		fmt.Fprint(out, format.CombinePackages(p.combined, opts))
+	}
+	if *mergeSameName {
+		p.printMerged()
+	}
+	// The output is finished before a go test failure exits, which would
+	// skip deferred calls.
+	if *outputFormat == "junit" {
+		fmt.Fprintln(out, "</testsuites>")
+	}
+	if out != os.Stdout {
+		out.Close()
+	}
+	if summary != nil {
+		summary.Close()
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Println(err)
+	if testErr != nil {
+		fmt.Fprintln(os.Stderr, "prettybench: go test:", testErr)
 		os.Exit(1)
 	}
 }
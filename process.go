@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/prettybench/format"
+	"golang.org/x/tools/benchmark/parse"
+)
+
+// A processor reads benchmark output, passing other lines through and
+// printing each group of benchmarks as it ends.
+type processor struct {
+	current *format.BenchOutputGroup
+	lineNum int
+	// Number of non-empty groups seen so far
+	groups int
+	// Set once -max-groups has been reached
+	truncated bool
+	// Groups saved for -combine-packages
+	combined []*format.BenchOutputGroup
+	// Groups saved for -format=prometheus and -format=json, which print
+	// them all at the end
+	metrics []*format.BenchOutputGroup
+	// Groups saved for -merge-same-name
+	all []*format.BenchOutputGroup
+	// Whether a group of the current input has been printed, so that the
+	// next one is separated from it
+	printed bool
+	// Set once the -benchmem hint has been printed
+	hinted bool
+	// A line that may start a table printed by prettybench, held until the
+	// next line shows whether it does
+	header string
+	// Set once the input turns out to be prettybench output, which is then
+	// passed through unchanged
+	formatted bool
+	// Whether the last line was forwarded by forwardMatcher, so that its
+	// indented continuation lines are too
+	forwarding bool
+}
+
+func (p *processor) flush() {
+	g := p.current
+	p.current = &format.BenchOutputGroup{File: g.File}
+	if len(g.Lines) == 0 {
+		return
+	}
+	p.groups++
+	g.Aggregate(&opts)
+	if *checkCPU {
+		checkProcs(g)
+	}
+	if summary != nil {
+		writeSummary(g)
+	}
+	if g.Measured&(parse.AllocedBytesPerOp|parse.AllocsPerOp) == 0 && !p.hinted {
+		fmt.Fprintln(os.Stderr, "prettybench: hint: re-run with go test -bench=. -benchmem to see allocation columns")
+		p.hinted = true
+	}
+	if *combinePkgs {
+		p.combined = append(p.combined, g)
+	}
+	if *mergeSameName {
+		p.all = append(p.all, g)
+	}
+	switch {
+	case *outputFormat == "ndjson":
+		printJSONLine(&groupEndJSON{Type: "group_end", GroupID: p.groups, Package: g.Package})
+	case *outputFormat == "prometheus", *outputFormat == "json":
+		p.metrics = append(p.metrics, g)
+	case !*combinePkgs:
+		s := format.Format([]*format.BenchOutputGroup{g}, opts)
+		if s == "" {
+			return
+		}
+		if p.printed && !*noGroupSep {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprint(out, s)
+		p.printed = true
+	}
+}
+
+// run processes the benchmark output in r, which was read from the named
+// file (or from stdin if file is ""). Gzip-compressed output, such as an
+// archived .gz file, is decompressed first.
+func (p *processor) run(r io.Reader, file string) {
+	p.current = &format.BenchOutputGroup{File: file}
+	p.lineNum = 0
+	p.printed = false
+	p.header, p.formatted = "", false
+	r, err := format.Decompress(r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "prettybench:", err)
+		os.Exit(1)
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p.limitReached() {
+			return
+		}
+		// go test on Windows ends its lines with \r\n.
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		p.lineNum++
+		p.processLine(text)
+	}
+	if p.header != "" {
+		p.handleLine(p.header)
+		p.header = ""
+	}
+	// Output without a final ok line, such as from testing.Benchmark
+	// calls in a custom main, still ends its last group at EOF.
+	if len(p.current.Lines) > 0 {
+		debugf(1, "flushed group of %d benchmarks at EOF (line %d)", len(p.current.Lines), p.lineNum)
+		p.flush()
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// limitReached reports whether -max-groups groups have been printed, so
+// that no more input should be read, saying so on stderr the first time.
+func (p *processor) limitReached() bool {
+	if !p.truncated && *maxGroups > 0 && p.groups >= *maxGroups {
+		fmt.Fprintf(os.Stderr, "prettybench: truncated after %d groups\n", p.groups)
+		p.truncated = true
+	}
+	return p.truncated
+}
+
+// detectFormatted checks whether text is part of a table that prettybench
+// printed, as when its output is piped back into it, and reports whether it
+// has dealt with the line. Such tables are passed through unchanged, with a
+// warning.
+func (p *processor) detectFormatted(text string) bool {
+	if p.formatted {
+		fmt.Println(text)
+		return true
+	}
+	if p.header != "" {
+		header := p.header
+		p.header = ""
+		if tableRuleMatcher.MatchString(text) {
+			fmt.Fprintln(os.Stderr, "prettybench: input looks like prettybench output already; passing it through (use -raw to parse it anyway)")
+			p.formatted = true
+			fmt.Println(header)
+			fmt.Println(text)
+			return true
+		}
+		p.handleLine(header)
+	}
+	if tableHeaderMatcher.MatchString(text) {
+		p.header = text
+		return true
+	}
+	return false
+}
+
+func (p *processor) processLine(text string) {
+	if !*rawInput && p.detectFormatted(text) {
+		return
+	}
+	p.handleLine(text)
+}
+
+// handleLine processes a line of go test output.
+func (p *processor) handleLine(text string) {
+	line, err := format.ParseLine(text)
+	if err == nil && (!selected(line) || line.N < *minIters || line.NsPerOp < *minNsPerOp) {
+		err = format.ErrNotBenchLine
+	}
+	switch err {
+	case format.ErrNotBenchLine:
+		suppress := noPassthrough.suppress(p.current)
+		// Diagnostics and test results span several lines, of which the
+		// later ones are indented.
+		indented := strings.HasPrefix(text, "\t") || strings.HasPrefix(text, "    ")
+		p.forwarding = forwardMatcher.MatchString(text) || (p.forwarding && indented)
+		if p.forwarding {
+			suppress = false
+		}
+		// In auto mode the package summary lines are always kept, whether
+		// the package passed or failed.
+		if noPassthrough == "auto" && failLineMatcher.MatchString(text) {
+			suppress = false
+		}
+		if pkg, ok := format.ParseOKLine(text); ok {
+			if noPassthrough == "auto" {
+				suppress = false
+			}
+			p.current.Package = pkg
+			debugf(1, "flushed group of %d benchmarks at ok (line %d)", len(p.current.Lines), p.lineNum)
+			p.flush()
+		} else if m := prologueMatcher.FindStringSubmatch(text); m != nil {
+			if *multiInvoke && (len(p.current.Lines) > 0 || hasPrologue(p.current, m[1])) {
+				debugf(1, "flushed group of %d benchmarks at new invocation (line %d)", len(p.current.Lines), p.lineNum)
+				p.flush()
+			}
+			setPlatform(p.current, m[1], text[len(m[0]):])
+			if *multiInvoke {
+				p.current.Prologue = append(p.current.Prologue, text)
+				return
+			}
+			debugf(2, "read prologue line: %q", text)
+		} else {
+			if m := goVersionMatcher.FindStringSubmatch(text); m != nil {
+				p.current.GoVersion = m[1]
+			}
+			debugf(2, "skipped non-bench line: %q", text)
+		}
+		if !suppress {
+			fmt.Println(text)
+		}
+	case nil:
+		p.forwarding = false
+		debugf(2, "parsed benchmark %s (line %d)", line.Name, p.lineNum)
+		if *showRaw {
+			fmt.Fprintf(os.Stderr, "prettybench: line %d: %+v\n", p.lineNum, *line)
+		}
+		n := len(p.current.Lines)
+		p.current.AddLine(line, &opts)
+		if *outputFormat == "ndjson" && len(p.current.Lines) > n {
+			j := format.NewBenchJSON(line)
+			j.Type = "benchmark"
+			j.GroupID = p.groups + 1
+			printJSONLine(j)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "prettybench unrecognized line:")
+		fmt.Println(text)
+	}
+}
+
+// setPlatform records the value of the prologue line with the given key in
+// g.
+func setPlatform(g *format.BenchOutputGroup, key, value string) {
+	switch key {
+	case "goos":
+		g.GOOS = value
+	case "goarch":
+		g.GOARCH = value
+	case "cpu":
+		g.CPU = value
+	}
+}
+
+// writeSummary appends g to the GitHub Actions step summary as a Markdown
+// table, under a heading naming its package.
+func writeSummary(g *format.BenchOutputGroup) {
+	md := opts
+	md.Format = "markdown"
+	md.Color, md.EmitBenchFormat = false, false
+	// Lines above the table would run into it, so the package heading is
+	// all that precedes it.
+	md.ShowPackage, md.ShowGoVersion, md.NoCaption = false, false, true
+	if g.Package != "" {
+		fmt.Fprintf(summary, "### %s\n\n", g.Package)
+	}
+	fmt.Fprintf(summary, "%s\n", format.Format([]*format.BenchOutputGroup{g}, md))
+}
+
+// runGoTest runs the benchmarks matching -run-bench in the current directory
+// and processes their output. Its error is that of go test. If -max-groups
+// stops the processing early, go test is killed rather than left to block
+// on a full pipe, and its error is ignored.
+func (p *processor) runGoTest() error {
+	args := []string{"test", "-run=^$", "-bench=" + *runBench}
+	if *benchTime != "" {
+		args = append(args, "-benchtime="+*benchTime)
+	}
+	if *benchMem {
+		args = append(args, "-benchmem")
+	}
+	if *benchCount > 0 {
+		args = append(args, "-count="+strconv.Itoa(*benchCount))
+	}
+	if *benchCPU != "" {
+		args = append(args, "-cpu="+*benchCPU)
+	}
+	debugf(1, "running go %s", strings.Join(args, " "))
+	cmd := exec.Command("go", args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.run(stdout, "")
+	if p.truncated {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil
+	}
+	return cmd.Wait()
+}
+
+// printMerged prints, for each package read from more than one file, a
+// table comparing its times across those files.
+func (p *processor) printMerged() {
+	var packages []string
+	byPackage := make(map[string][]*format.BenchOutputGroup)
+	for _, g := range p.all {
+		if g.Package == "" || g.File == "" {
+			continue
+		}
+		if _, ok := byPackage[g.Package]; !ok {
+			packages = append(packages, g.Package)
+		}
+		byPackage[g.Package] = append(byPackage[g.Package], g)
+	}
+	for _, pkg := range packages {
+		groups := byPackage[pkg]
+		if len(groups) < 2 {
+			continue
+		}
+		var files []string
+		for _, g := range groups {
+			files = append(files, g.File)
+		}
+		heading("# merged: "+pkg, false)
+		fmt.Fprint(out, format.Combine(groups, files, pkg, opts))
+	}
+}
+
+// checkProcs warns on stderr if the benchmarks in g were run with more than
+// one GOMAXPROCS value, as with go test -cpu=1,8.
+func checkProcs(g *format.BenchOutputGroup) {
+	distinct := make(map[int]bool)
+	for _, line := range g.Lines {
+		distinct[line.Procs] = true
+	}
+	if len(distinct) < 2 {
+		return
+	}
+	where := ""
+	if g.Package != "" {
+		where = " in " + g.Package
+	}
+	fmt.Fprintf(os.Stderr, "prettybench: warning: benchmarks%s ran with %d different GOMAXPROCS values:\n", where, len(distinct))
+	for _, line := range g.Lines {
+		fmt.Fprintf(os.Stderr, "    %s (GOMAXPROCS=%d)\n", line.Name, line.Procs)
+	}
+	fmt.Fprintln(os.Stderr, "prettybench: run go test with a single -cpu=N value to compare like with like")
+}
+
+// hasPrologue reports whether g has already seen the prologue line for key
+// (such as "goos").
+func hasPrologue(g *format.BenchOutputGroup, key string) bool {
+	for _, line := range g.Prologue {
+		if strings.HasPrefix(line, key+": ") {
+			return true
+		}
+	}
+	return false
+}
+
+// groupEndJSON is the -format=ndjson event that closes a group.
+type groupEndJSON struct {
+	Type    string `json:"type"`
+	GroupID int    `json:"group_id"`
+	Package string `json:"package,omitempty"`
+}
+
+// printJSONLine writes v to out as a single line of JSON.
+func printJSONLine(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(out, string(b))
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import "os"
+
+// terminalWidth returns the number of columns of the terminal attached to
+// f, or false if f is not a terminal.
+func terminalWidth(f *os.File) (int, bool) {
+	return 0, false
+}